@@ -0,0 +1,225 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+)
+
+// DynamoDB bills a read unit per 4 KB read with strong consistency (half for
+// eventually consistent reads) and a write unit per 1 KB written, rounding
+// each item up separately
+const (
+	readUnitBytes  = 4096
+	writeUnitBytes = 1024
+)
+
+// Operations a capacity workload can describe, in ops/sec
+const (
+	CapacityOpGetProduct      = "get_product"
+	CapacityOpGetCart         = "get_cart"
+	CapacityOpGetCartExpanded = "get_cart_expanded" // GET /shopping-carts/:id?expand=products
+	CapacityOpCreateCart      = "create_cart"
+	CapacityOpAddToCart       = "add_to_cart"
+	CapacityOpSetCartQuantity = "set_cart_quantity"
+	CapacityOpUpdateCart      = "update_cart" // PATCH /shopping-carts/:id
+)
+
+// capacityOperations lists every operation EstimateCapacity can size
+var capacityOperations = []string{
+	CapacityOpGetProduct,
+	CapacityOpGetCart,
+	CapacityOpGetCartExpanded,
+	CapacityOpCreateCart,
+	CapacityOpAddToCart,
+	CapacityOpSetCartQuantity,
+	CapacityOpUpdateCart,
+}
+
+// CapacityWorkload describes a load to provision for
+type CapacityWorkload struct {
+	Operations   map[string]float64 // ops/sec keyed by operation name
+	ItemsPerCart int                // average cart lines
+}
+
+// Capacity is a number of read and write capacity units per second
+type Capacity struct {
+	RCU float64 `json:"rcu"`
+	WCU float64 `json:"wcu"`
+}
+
+// CapacityEstimate is the result of EstimateCapacity
+type CapacityEstimate struct {
+	ProductBytes    int                 `json:"product_bytes"`
+	CartBytes       int                 `json:"cart_bytes"`
+	ItemsPerCart    int                 `json:"items_per_cart"`
+	ConsistentReads bool                `json:"consistent_reads"`
+	Operations      map[string]Capacity `json:"operations"`
+	Products        Capacity            `json:"products_table"`
+	Carts           Capacity            `json:"carts_table"`
+	Total           Capacity            `json:"total"`
+}
+
+// readUnits is the RCU consumed reading one item of size bytes
+func readUnits(size int) float64 {
+	units := math.Ceil(float64(max(size, 1)) / readUnitBytes)
+	if !consistentReads {
+		units /= 2
+	}
+	return units
+}
+
+// writeUnits is the WCU consumed writing one item of size bytes
+func writeUnits(size int) float64 {
+	return math.Ceil(float64(max(size, 1)) / writeUnitBytes)
+}
+
+// EstimateCapacity sizes the DynamoDB capacity a workload needs, following
+// the reads and writes each handler makes. Item sizes come from the products
+// loaded in memory and a cart with ItemsPerCart lines built from them. The
+// estimate ignores retries, conditional check failures and background work
+// such as reservation sweeps, so leave some headroom.
+func EstimateCapacity(workload CapacityWorkload) CapacityEstimate {
+	productBytes, sample := averageProductSize()
+	cartBytes := cartSize(workload.ItemsPerCart, sample)
+	emptyCartBytes := cartSize(0, sample)
+
+	productRead, productWrite := readUnits(productBytes), writeUnits(productBytes)
+	cartRead, cartWrite := readUnits(cartBytes), writeUnits(cartBytes)
+
+	// Reads and writes per operation, split by table
+	type cost struct{ products, carts Capacity }
+	costs := map[string]cost{
+		CapacityOpGetProduct: {products: Capacity{RCU: productRead}},
+		CapacityOpGetCart:    {carts: Capacity{RCU: cartRead}},
+		// BatchGetItem rounds every product up separately
+		CapacityOpGetCartExpanded: {
+			products: Capacity{RCU: float64(workload.ItemsPerCart) * productRead},
+			carts:    Capacity{RCU: cartRead},
+		},
+		CapacityOpCreateCart: {carts: Capacity{WCU: writeUnits(emptyCartBytes)}},
+		// GetProduct, GetCart, PutItem of the cart and a popularity UpdateItem,
+		// which is billed by the size of the whole product
+		CapacityOpAddToCart: {
+			products: Capacity{RCU: productRead, WCU: productWrite},
+			carts:    Capacity{RCU: cartRead, WCU: cartWrite},
+		},
+		CapacityOpSetCartQuantity: {
+			products: Capacity{RCU: productRead},
+			carts:    Capacity{RCU: cartRead, WCU: cartWrite},
+		},
+		CapacityOpUpdateCart: {carts: Capacity{WCU: cartWrite}},
+	}
+	// Reservations update the product's stock on every cart line change
+	if reservationTTL > 0 {
+		for _, op := range []string{CapacityOpAddToCart, CapacityOpSetCartQuantity} {
+			c := costs[op]
+			c.products.WCU += productWrite
+			costs[op] = c
+		}
+	}
+
+	estimate := CapacityEstimate{
+		ProductBytes:    productBytes,
+		CartBytes:       cartBytes,
+		ItemsPerCart:    workload.ItemsPerCart,
+		ConsistentReads: consistentReads,
+		Operations:      make(map[string]Capacity, len(workload.Operations)),
+	}
+	for op, rate := range workload.Operations {
+		c := costs[op]
+		estimate.Operations[op] = Capacity{
+			RCU: rate * (c.products.RCU + c.carts.RCU),
+			WCU: rate * (c.products.WCU + c.carts.WCU),
+		}
+		estimate.Products.RCU += rate * c.products.RCU
+		estimate.Products.WCU += rate * c.products.WCU
+		estimate.Carts.RCU += rate * c.carts.RCU
+		estimate.Carts.WCU += rate * c.carts.WCU
+	}
+
+	// Provisioned capacity is set in whole units
+	estimate.Products = Capacity{RCU: math.Ceil(estimate.Products.RCU), WCU: math.Ceil(estimate.Products.WCU)}
+	estimate.Carts = Capacity{RCU: math.Ceil(estimate.Carts.RCU), WCU: math.Ceil(estimate.Carts.WCU)}
+	estimate.Total = Capacity{
+		RCU: estimate.Products.RCU + estimate.Carts.RCU,
+		WCU: estimate.Products.WCU + estimate.Carts.WCU,
+	}
+	return estimate
+}
+
+// averageProductSize returns the mean stored size of the products loaded in
+// memory, and one of them to model cart lines on. With no products loaded it
+// falls back to a typical generated product.
+func averageProductSize() (int, ProductItem) {
+	total, count := 0, 0
+	var sample ProductItem
+	syncProducts.Range(func(_, value any) bool {
+		product := productItemFromItem(value.(Item))
+		item, err := marshalProduct(product)
+		if err != nil {
+			return true
+		}
+		if count == 0 {
+			sample = product
+		}
+		total += estimateItemSize(item)
+		count++
+		return true
+	})
+	if count > 0 {
+		return total / count, sample
+	}
+
+	sample = ProductItem{
+		ID:           100000,
+		SKU:          "SKU-100000",
+		Manufacturer: "Manufacturer 42",
+		CategoryID:   42,
+		Weight:       12.5,
+		SomeOtherID:  4242,
+		Name:         "Product 100000",
+		Category:     "Electronics",
+		Description:  strings.Repeat("x", 200),
+		Brand:        "Brand 42",
+		PriceCents:   19999,
+		Stock:        1000,
+	}
+	item, err := marshalProduct(sample)
+	if err != nil {
+		return 0, sample
+	}
+	return estimateItemSize(item), sample
+}
+
+// cartSize is the stored size of a cart with lines lines copied from product
+func cartSize(lines int, product ProductItem) int {
+	now := nowRFC3339()
+	cart := CartItem{
+		CustomerID: 1000000,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		ExpiresAt:  time.Now().Unix(),
+		Items:      make([]CartProduct, lines),
+	}
+	for i := range cart.Items {
+		cart.Items[i] = CartProduct{
+			ID:           product.ID + i,
+			Manufacturer: product.Manufacturer,
+			Category:     product.Category,
+			Quantity:     10,
+			PriceCents:   linePrice(&product),
+		}
+		if reservationTTL > 0 {
+			cart.Items[i].Reserved = 10
+			cart.Items[i].ReservedUntil = cart.ExpiresAt
+		}
+	}
+	item, err := attributevalue.MarshalMap(cart)
+	if err != nil {
+		return 0
+	}
+	return estimateItemSize(item)
+}
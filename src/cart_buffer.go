@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// cartBuffer coalesces add-to-cart requests when CART_WRITE_BEHIND_MS is set,
+// nil otherwise
+var cartBuffer *CartWriteBuffer
+
+// CartWriteBuffer is a write-behind buffer for add-to-cart requests. Adds for
+// the same customer arriving within one flush interval are merged and applied
+// with a single cart read and write (AddToCartBatch), instead of one
+// read-modify-write per request.
+//
+// The trade-off is that buffered adds are acknowledged before they are
+// written: reads may not see them for up to one interval, and failures (e.g.
+// a full cart) are only logged at flush time, for the failing line alone.
+type CartWriteBuffer struct {
+	interval time.Duration
+
+	mu      sync.Mutex
+	pending map[int]map[int]int // customer ID -> product ID -> quantity to add
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewCartWriteBuffer starts a buffer that flushes every interval
+func NewCartWriteBuffer(interval time.Duration) *CartWriteBuffer {
+	b := &CartWriteBuffer{
+		interval: interval,
+		pending:  make(map[int]map[int]int),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Add queues quantity of productID to be added to the customer's cart
+func (b *CartWriteBuffer) Add(customerID, productID, quantity int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.pending[customerID] == nil {
+		b.pending[customerID] = make(map[int]int)
+	}
+	b.pending[customerID][productID] += quantity
+}
+
+func (b *CartWriteBuffer) run() {
+	defer close(b.stopped)
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			b.flush(context.Background())
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// flush writes every pending customer's adds, one cart write per customer.
+// The adds were already acknowledged, so when a customer's batch fails each
+// line is applied on its own: one bad line (a deleted product, a full cart)
+// then only drops itself.
+func (b *CartWriteBuffer) flush(ctx context.Context) {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make(map[int]map[int]int)
+	b.mu.Unlock()
+
+	for customerID, quantities := range pending {
+		err := retryCartConflicts(func() error {
+			return AddToCartBatch(ctx, customerID, quantities)
+		})
+		if err == nil {
+			continue
+		}
+		log.Printf("Warning: buffered cart adds for customer %d failed as a batch, applying them one by one: %v", customerID, err)
+
+		for productID, quantity := range quantities {
+			err := retryCartConflicts(func() error {
+				_, _, err := AddToCart(ctx, customerID, productID, quantity)
+				return err
+			})
+			if err != nil {
+				log.Printf("Warning: dropped buffered add of %d of product %d for customer %d: %v", quantity, productID, customerID, err)
+			}
+		}
+	}
+}
+
+// maxFlushAttempts bounds the retries of a buffered write that keeps losing
+// the race with other writers of the same cart
+const maxFlushAttempts = 3
+
+// retryCartConflicts calls write until it succeeds, fails with anything but
+// ErrCartConflict, or has been tried maxFlushAttempts times
+func retryCartConflicts(write func() error) error {
+	var err error
+	for attempt := 0; attempt < maxFlushAttempts; attempt++ {
+		if err = write(); !errors.Is(err, ErrCartConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+// Stop stops the flush loop and writes whatever is still pending. Call it
+// after the HTTP server has stopped accepting requests.
+func (b *CartWriteBuffer) Stop(ctx context.Context) {
+	close(b.stop)
+	<-b.stopped
+	b.flush(ctx)
+}
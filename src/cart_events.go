@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync/atomic"
+)
+
+// cartEvents publishes cart-change events when CART_EVENTS_SINK is set, nil otherwise
+var cartEvents *CartEventEmitter
+
+// cartEventsChannel is where in-process consumers read events with
+// CART_EVENTS_SINK=memory, nil otherwise
+var cartEventsChannel *ChannelCartEventSink
+
+// Cart event sinks selectable with CART_EVENTS_SINK
+const (
+	CartEventsSinkNone   = "none"
+	CartEventsSinkLog    = "log"
+	CartEventsSinkMemory = "memory"
+)
+
+// CartEventType is what a cart change did
+type CartEventType string
+
+const (
+	CartEventItemAdded   CartEventType = "item_added"   // a product was new to the cart
+	CartEventItemUpdated CartEventType = "item_updated" // an existing line's quantity changed
+	CartEventItemRemoved CartEventType = "item_removed" // a line left the cart, e.g. moved to another cart
+	CartEventCartDeleted CartEventType = "cart_deleted" // the whole cart was erased
+)
+
+// CartEvent describes one change to a customer's cart, for downstream analytics
+type CartEvent struct {
+	CustomerID int           `json:"customer_id"`
+	Type       CartEventType `json:"type"`
+	ProductID  int           `json:"product_id,omitempty"` // unset for cart_deleted
+	Timestamp  string        `json:"timestamp"`            // RFC 3339, UTC
+}
+
+// CartEventSink receives published cart events. Publish is only ever called
+// from the emitter's goroutine, one event at a time, so a sink may block
+// without slowing requests down.
+type CartEventSink interface {
+	Publish(event CartEvent)
+}
+
+// LogCartEventSink writes each event to the log as JSON
+type LogCartEventSink struct{}
+
+func (LogCartEventSink) Publish(event CartEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Warning: failed to marshal cart event: %v", err)
+		return
+	}
+	log.Printf("cart event: %s", line)
+}
+
+// ChannelCartEventSink hands events to in-process consumers through C. When
+// consumers fall behind (or there are none yet) the oldest buffered event is
+// discarded, so C always holds the most recent ones.
+type ChannelCartEventSink struct {
+	C chan CartEvent
+}
+
+// NewChannelCartEventSink creates a sink buffering up to size events
+func NewChannelCartEventSink(size int) *ChannelCartEventSink {
+	return &ChannelCartEventSink{C: make(chan CartEvent, size)}
+}
+
+func (s *ChannelCartEventSink) Publish(event CartEvent) {
+	for {
+		select {
+		case s.C <- event:
+			return
+		default:
+		}
+		// Full: make room by dropping the oldest, unless a consumer just did
+		select {
+		case <-s.C:
+		default:
+		}
+	}
+}
+
+// CartEventEmitter queues events and publishes them to a sink from its own
+// goroutine. Emit never blocks: when the queue is full the event is dropped
+// and counted, since losing analytics events is better than slowing down
+// cart writes.
+type CartEventEmitter struct {
+	sink    CartEventSink
+	queue   chan CartEvent
+	dropped atomic.Int64
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewCartEventEmitter starts an emitter queueing up to size events for sink
+func NewCartEventEmitter(sink CartEventSink, size int) *CartEventEmitter {
+	e := &CartEventEmitter{
+		sink:    sink,
+		queue:   make(chan CartEvent, size),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// Emit queues an event without waiting for the sink
+func (e *CartEventEmitter) Emit(event CartEvent) {
+	select {
+	case e.queue <- event:
+	default:
+		// Log the first drop and then every 1000th, not every one
+		if dropped := e.dropped.Add(1); dropped%1000 == 1 {
+			log.Printf("Warning: cart event queue full, %d events dropped so far", dropped)
+		}
+	}
+}
+
+func (e *CartEventEmitter) run() {
+	defer close(e.stopped)
+
+	for {
+		select {
+		case event := <-e.queue:
+			e.sink.Publish(event)
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+// Stop stops the publishing loop and publishes whatever is still queued,
+// giving up when ctx is done. Call it after the HTTP server and the cart
+// write buffer have stopped; events emitted afterwards are never published.
+func (e *CartEventEmitter) Stop(ctx context.Context) {
+	close(e.stop)
+	<-e.stopped
+
+	for {
+		select {
+		case event := <-e.queue:
+			e.sink.Publish(event)
+		case <-ctx.Done():
+			log.Printf("Warning: %d cart events not published before shutdown", len(e.queue))
+			return
+		default:
+			return
+		}
+	}
+}
+
+// emitCartEvent publishes a change to the customer's cart if events are enabled
+func emitCartEvent(customerID int, eventType CartEventType, productID int) {
+	if cartEvents == nil {
+		return
+	}
+	cartEvents.Emit(CartEvent{
+		CustomerID: customerID,
+		Type:       eventType,
+		ProductID:  productID,
+		Timestamp:  nowRFC3339(),
+	})
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Config holds every setting the service reads from the environment.
+// It is loaded and validated once at startup by LoadConfig.
+type Config struct {
+	// Storage
+	StoreBackend string // backend of the cart and product handlers, only dynamodb so far
+
+	// AWS / DynamoDB
+	AWSRegion            string
+	ProductsTable        string
+	CartsTable           string
+	WishlistsTable       string // optional, wishlists are disabled when empty
+	PromosTable          string // optional, promo codes are disabled when empty
+	CountersTable        string // optional, new product IDs then come from a scan
+	DynamoMaxConcurrency int
+	ConsistentReads      bool // strongly consistent GetItem/BatchGetItem, at twice the read capacity
+	ScanSegments         int  // parallel segments of full-table scans
+
+	// Carts
+	MaxCartItems        int
+	DefaultCartQuantity int // added when an add-to-cart request omits quantity
+	MaxItemQuantity     int // cap on one line's quantity
+	CartTTL             time.Duration
+	CartWriteBehind     time.Duration  // flush interval of buffered cart adds, 0 disables buffering
+	ReservationTTL      time.Duration  // how long cart lines hold stock, 0 disables reservations
+	TaxRate             float64        // applied to cart subtotals, e.g. 0.0725
+	ShippingRates       []ShippingTier // weight tiers of shipping estimates, ascending
+	CartEventsSink      string         // where cart-change events go: none, log or memory
+	CartEventsBuffer    int            // events queued before new ones are dropped
+
+	// Products
+	PopularityRefresh  time.Duration // how often /products/popular is recomputed
+	FacetsRefresh      time.Duration // how often /products/categories and /products/brands are rescanned
+	ProductCacheMaxAge int           // seconds, Cache-Control max-age of product reads
+	SearchMaxScan      int           // products examined per search, 0 for no cap
+	HighlightPre       string        // inserted before search matches with highlight=true
+	HighlightPost      string        // inserted after them
+
+	// Seeding
+	SeedBatchSize        int
+	SeedDelay            time.Duration
+	SeedDryRun           bool
+	SeedMode             string // overwrite (only seeds an empty table) or missing
+	ProductGenConfigPath string
+	CompressDescriptions bool // gzip product descriptions on write
+
+	// HTTP server
+	Port                int
+	GinMode             string // debug, release or test
+	LogFormat           string // access log format, text or json
+	ReadTimeout         time.Duration
+	WriteTimeout        time.Duration
+	ShutdownTimeout     time.Duration // grace period for in-flight requests and seeding
+	MaxInflightRequests int           // 0 disables the concurrent request cap
+	InflightWait        time.Duration // how long a request waits for a slot before 503
+	RequestTimeout      time.Duration // overall deadline of a request, 0 disables it
+	HealthLatencyLimit  time.Duration // /health/detail reports degraded above this DynamoDB latency
+	Debug               bool          // adds X-Dynamo-Calls response headers
+	APIToken            string        // secret, never logged
+	AdminToken          string        // secret, never logged
+
+	// Tracing, disabled when no OTLP endpoint is set
+	OTLPEndpoint string
+}
+
+// configLoader accumulates validation errors so LoadConfig can report
+// every problem at once instead of failing on the first one
+type configLoader struct {
+	errs []error
+}
+
+// required reads a variable that has no default. example is a typical value
+// shown in the error, so a first run tells the developer what to set.
+func (l *configLoader) required(name, example string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		l.errs = append(l.errs, fmt.Errorf("%s is required, e.g. %s=%s", name, name, example))
+	}
+	return value
+}
+
+// intInRange reads an integer variable, using defaultValue when it is unset
+func (l *configLoader) intInRange(name string, defaultValue, min, max int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < min || value > max {
+		l.errs = append(l.errs, fmt.Errorf("%s=%q must be an integer between %d and %d", name, raw, min, max))
+		return defaultValue
+	}
+	return value
+}
+
+// floatInRange reads a decimal variable, using defaultValue when it is unset
+func (l *configLoader) floatInRange(name string, defaultValue, min, max float64) float64 {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || value < min || value > max {
+		l.errs = append(l.errs, fmt.Errorf("%s=%q must be a number between %g and %g", name, raw, min, max))
+		return defaultValue
+	}
+	return value
+}
+
+// oneOf reads a variable that must be one of allowed, using defaultValue when it is unset
+func (l *configLoader) oneOf(name, defaultValue string, allowed ...string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	if !slices.Contains(allowed, value) {
+		l.errs = append(l.errs, fmt.Errorf("%s=%q must be one of %s", name, value, strings.Join(allowed, ", ")))
+		return defaultValue
+	}
+	return value
+}
+
+// shippingTiers reads a comma separated list of maxWeight:costCents tiers,
+// e.g. "1:499,5:899,20:1499", using defaultValue when it is unset. Weights
+// must be positive and ascending, costs non-negative.
+func (l *configLoader) shippingTiers(name string, defaultValue []ShippingTier) []ShippingTier {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return defaultValue
+	}
+	var tiers []ShippingTier
+	for _, entry := range strings.Split(raw, ",") {
+		weight, cost, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		maxWeight, weightErr := strconv.ParseFloat(weight, 64)
+		costCents, costErr := strconv.Atoi(cost)
+		if !ok || weightErr != nil || costErr != nil || maxWeight <= 0 || costCents < 0 ||
+			(len(tiers) > 0 && maxWeight <= tiers[len(tiers)-1].MaxWeight) {
+			l.errs = append(l.errs, fmt.Errorf("%s=%q must be ascending maxWeight:costCents pairs, e.g. 1:499,5:899", name, raw))
+			return defaultValue
+		}
+		tiers = append(tiers, ShippingTier{MaxWeight: maxWeight, CostCents: costCents})
+	}
+	return tiers
+}
+
+// formatShippingTiers renders tiers in the SHIPPING_RATES format
+func formatShippingTiers(tiers []ShippingTier) string {
+	entries := make([]string, 0, len(tiers))
+	for _, tier := range tiers {
+		entries = append(entries, fmt.Sprintf("%g:%d", tier.MaxWeight, tier.CostCents))
+	}
+	return strings.Join(entries, ",")
+}
+
+func (l *configLoader) boolean(name string) bool {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return false
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s=%q must be true or false", name, raw))
+	}
+	return value
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// LoadConfig reads and validates all environment variables up front. The
+// returned error lists everything that is missing or invalid.
+func LoadConfig() (*Config, error) {
+	l := &configLoader{}
+
+	cfg := &Config{
+		StoreBackend: l.oneOf("STORE_BACKEND", StoreBackendDynamoDB, StoreBackendDynamoDB),
+
+		AWSRegion:            l.required("AWS_REGION", "us-west-2"),
+		ProductsTable:        l.required("PRODUCTS_TABLE", "ecommerce-products"),
+		CartsTable:           l.required("CARTS_TABLE", "ecommerce-carts"),
+		WishlistsTable:       os.Getenv("WISHLISTS_TABLE"),
+		PromosTable:          os.Getenv("PROMOS_TABLE"),
+		CountersTable:        os.Getenv("COUNTERS_TABLE"),
+		DynamoMaxConcurrency: l.intInRange("DYNAMO_MAX_CONCURRENCY", 64, 1, 10000),
+		ConsistentReads:      l.boolean("DYNAMO_CONSISTENT_READS"),
+		ScanSegments:         l.intInRange("DYNAMO_SCAN_SEGMENTS", 4, 1, 64),
+
+		MaxCartItems:        l.intInRange("MAX_CART_ITEMS", 100, 1, 10000),
+		DefaultCartQuantity: l.intInRange("DEFAULT_CART_QUANTITY", 1, 1, 1000),
+		MaxItemQuantity:     l.intInRange("MAX_ITEM_QUANTITY", 10000, 1, 1000000000),
+		CartTTL:             time.Duration(l.intInRange("CART_TTL_HOURS", 720, 1, 24*365)) * time.Hour,
+		CartWriteBehind:     time.Duration(l.intInRange("CART_WRITE_BEHIND_MS", 0, 0, 60000)) * time.Millisecond,
+		ReservationTTL:      time.Duration(l.intInRange("RESERVATION_TTL_MINUTES", 0, 0, 24*60)) * time.Minute,
+		TaxRate:             l.floatInRange("TAX_RATE", 0, 0, 1),
+		ShippingRates:       l.shippingTiers("SHIPPING_RATES", defaultShippingRates),
+		CartEventsSink:      l.oneOf("CART_EVENTS_SINK", CartEventsSinkNone, CartEventsSinkNone, CartEventsSinkLog, CartEventsSinkMemory),
+		CartEventsBuffer:    l.intInRange("CART_EVENTS_BUFFER", 1000, 1, 1000000),
+
+		PopularityRefresh:  time.Duration(l.intInRange("POPULARITY_REFRESH_SECONDS", 60, 1, 86400)) * time.Second,
+		FacetsRefresh:      time.Duration(l.intInRange("FACETS_REFRESH_SECONDS", 300, 1, 86400)) * time.Second,
+		ProductCacheMaxAge: l.intInRange("PRODUCT_CACHE_MAX_AGE", 60, 0, 86400),
+		SearchMaxScan:      l.intInRange("SEARCH_MAX_SCAN", 0, 0, 100000000),
+		HighlightPre:       firstNonEmpty(os.Getenv("SEARCH_HIGHLIGHT_PRE"), "<em>"),
+		HighlightPost:      firstNonEmpty(os.Getenv("SEARCH_HIGHLIGHT_POST"), "</em>"),
+
+		// 25 is the BatchWriteItem maximum
+		SeedBatchSize:        l.intInRange("SEED_BATCH_SIZE", 25, 1, 25),
+		SeedDelay:            time.Duration(l.intInRange("SEED_DELAY_MS", 0, 0, 60000)) * time.Millisecond,
+		SeedDryRun:           l.boolean("SEED_DRY_RUN"),
+		SeedMode:             l.oneOf("SEED_MODE", SeedModeOverwrite, SeedModeOverwrite, SeedModeMissing),
+		ProductGenConfigPath: os.Getenv("PRODUCT_GEN_CONFIG"),
+		CompressDescriptions: l.boolean("COMPRESS_DESCRIPTIONS"),
+
+		Port:                l.intInRange("PORT", 8080, 1, 65535),
+		GinMode:             l.oneOf("GIN_MODE", gin.ReleaseMode, gin.DebugMode, gin.ReleaseMode, gin.TestMode),
+		LogFormat:           l.oneOf("LOG_FORMAT", "text", "text", "json"),
+		ReadTimeout:         time.Duration(l.intInRange("HTTP_READ_TIMEOUT_MS", 10000, 1, 600000)) * time.Millisecond,
+		WriteTimeout:        time.Duration(l.intInRange("HTTP_WRITE_TIMEOUT_MS", 30000, 1, 600000)) * time.Millisecond,
+		ShutdownTimeout:     time.Duration(l.intInRange("SHUTDOWN_TIMEOUT_MS", 20000, 0, 600000)) * time.Millisecond,
+		MaxInflightRequests: l.intInRange("MAX_INFLIGHT_REQUESTS", 0, 0, 100000),
+		InflightWait:        time.Duration(l.intInRange("INFLIGHT_WAIT_MS", 100, 0, 60000)) * time.Millisecond,
+		RequestTimeout:      time.Duration(l.intInRange("REQUEST_TIMEOUT_MS", 10000, 0, 600000)) * time.Millisecond,
+		HealthLatencyLimit:  time.Duration(l.intInRange("HEALTH_LATENCY_THRESHOLD_MS", 200, 1, 60000)) * time.Millisecond,
+		Debug:               l.boolean("DEBUG"),
+		APIToken:            os.Getenv("API_TOKEN"),
+		AdminToken:          os.Getenv("ADMIN_TOKEN"),
+
+		// The exporter itself reads the OTEL_EXPORTER_OTLP_* variables, this
+		// only decides whether tracing is enabled
+		OTLPEndpoint: firstNonEmpty(os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"), os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")),
+	}
+
+	if len(l.errs) > 0 {
+		return nil, errors.Join(l.errs...)
+	}
+	return cfg, nil
+}
+
+// String renders the effective configuration for startup logs, with secrets redacted
+func (cfg *Config) String() string {
+	redact := func(secret string) string {
+		if secret == "" {
+			return "(unset)"
+		}
+		return "[REDACTED]"
+	}
+	orUnset := func(value string) string {
+		if value == "" {
+			return "(unset)"
+		}
+		return value
+	}
+
+	lines := []string{
+		"STORE_BACKEND=" + cfg.StoreBackend,
+		"AWS_REGION=" + cfg.AWSRegion,
+		"PRODUCTS_TABLE=" + cfg.ProductsTable,
+		"CARTS_TABLE=" + cfg.CartsTable,
+		"WISHLISTS_TABLE=" + orUnset(cfg.WishlistsTable),
+		"PROMOS_TABLE=" + orUnset(cfg.PromosTable),
+		"COUNTERS_TABLE=" + orUnset(cfg.CountersTable),
+		fmt.Sprintf("DYNAMO_MAX_CONCURRENCY=%d", cfg.DynamoMaxConcurrency),
+		fmt.Sprintf("DYNAMO_CONSISTENT_READS=%t", cfg.ConsistentReads),
+		fmt.Sprintf("DYNAMO_SCAN_SEGMENTS=%d", cfg.ScanSegments),
+		fmt.Sprintf("MAX_CART_ITEMS=%d", cfg.MaxCartItems),
+		fmt.Sprintf("DEFAULT_CART_QUANTITY=%d", cfg.DefaultCartQuantity),
+		fmt.Sprintf("MAX_ITEM_QUANTITY=%d", cfg.MaxItemQuantity),
+		fmt.Sprintf("CART_TTL=%v", cfg.CartTTL),
+		fmt.Sprintf("CART_WRITE_BEHIND=%v", cfg.CartWriteBehind),
+		fmt.Sprintf("RESERVATION_TTL=%v", cfg.ReservationTTL),
+		fmt.Sprintf("TAX_RATE=%g", cfg.TaxRate),
+		"SHIPPING_RATES=" + formatShippingTiers(cfg.ShippingRates),
+		"CART_EVENTS_SINK=" + cfg.CartEventsSink,
+		fmt.Sprintf("CART_EVENTS_BUFFER=%d", cfg.CartEventsBuffer),
+		fmt.Sprintf("POPULARITY_REFRESH=%v", cfg.PopularityRefresh),
+		fmt.Sprintf("FACETS_REFRESH=%v", cfg.FacetsRefresh),
+		fmt.Sprintf("PRODUCT_CACHE_MAX_AGE=%d", cfg.ProductCacheMaxAge),
+		fmt.Sprintf("SEARCH_MAX_SCAN=%d", cfg.SearchMaxScan),
+		"SEARCH_HIGHLIGHT_PRE=" + cfg.HighlightPre,
+		"SEARCH_HIGHLIGHT_POST=" + cfg.HighlightPost,
+		fmt.Sprintf("SEED_BATCH_SIZE=%d", cfg.SeedBatchSize),
+		fmt.Sprintf("SEED_DELAY=%v", cfg.SeedDelay),
+		fmt.Sprintf("SEED_DRY_RUN=%t", cfg.SeedDryRun),
+		"SEED_MODE=" + cfg.SeedMode,
+		"PRODUCT_GEN_CONFIG=" + orUnset(cfg.ProductGenConfigPath),
+		fmt.Sprintf("COMPRESS_DESCRIPTIONS=%t", cfg.CompressDescriptions),
+		fmt.Sprintf("PORT=%d", cfg.Port),
+		"GIN_MODE=" + cfg.GinMode,
+		"LOG_FORMAT=" + cfg.LogFormat,
+		fmt.Sprintf("HTTP_READ_TIMEOUT=%v", cfg.ReadTimeout),
+		fmt.Sprintf("HTTP_WRITE_TIMEOUT=%v", cfg.WriteTimeout),
+		fmt.Sprintf("SHUTDOWN_TIMEOUT=%v", cfg.ShutdownTimeout),
+		fmt.Sprintf("MAX_INFLIGHT_REQUESTS=%d", cfg.MaxInflightRequests),
+		fmt.Sprintf("INFLIGHT_WAIT=%v", cfg.InflightWait),
+		fmt.Sprintf("REQUEST_TIMEOUT=%v", cfg.RequestTimeout),
+		fmt.Sprintf("HEALTH_LATENCY_THRESHOLD=%v", cfg.HealthLatencyLimit),
+		fmt.Sprintf("DEBUG=%t", cfg.Debug),
+		"API_TOKEN=" + redact(cfg.APIToken),
+		"ADMIN_TOKEN=" + redact(cfg.AdminToken),
+		"OTEL_EXPORTER_OTLP_ENDPOINT=" + orUnset(cfg.OTLPEndpoint),
+	}
+	return strings.Join(lines, "\n  ")
+}
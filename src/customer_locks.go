@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// customerLocks serializes cart mutations per customer within this process,
+// so two concurrent read-modify-writes of the same cart on one instance can't
+// lose an update. It does nothing across instances: behind the ALB two
+// instances can still interleave, which the version conditions on every cart
+// write (see cartVersionCondition) are there to catch.
+var customerLocks = &keyedMutex{locks: make(map[int]*refMutex)}
+
+// keyedMutex is a set of mutexes created on first use and removed once no
+// goroutine holds or waits for them, so it doesn't grow with every customer
+// ever seen. A plain map behind one mutex is used rather than a sync.Map
+// because removing an entry safely needs the reference count and the map
+// updated together.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[int]*refMutex
+}
+
+// refMutex is a mutex whose lock can be abandoned when a context ends, so a
+// request past its deadline doesn't keep queueing for a busy cart
+type refMutex struct {
+	held chan struct{} // holds a value while locked
+	refs int           // holders plus waiters, guarded by keyedMutex.mu
+}
+
+// lockCustomers locks every given customer, in ascending order so that two
+// multi-customer operations (e.g. moving items between carts in opposite
+// directions) can't deadlock. It returns the function that unlocks them, or
+// ctx's error (with nothing locked) if ctx ends while waiting.
+func lockCustomers(ctx context.Context, customerIDs ...int) (unlock func(), err error) {
+	ids := slices.Compact(slices.Sorted(slices.Values(customerIDs)))
+	for i, id := range ids {
+		if err := customerLocks.lock(ctx, id); err != nil {
+			for _, locked := range slices.Backward(ids[:i]) {
+				customerLocks.unlock(locked)
+			}
+			return nil, err
+		}
+	}
+	return func() {
+		for _, id := range slices.Backward(ids) {
+			customerLocks.unlock(id)
+		}
+	}, nil
+}
+
+func (k *keyedMutex) lock(ctx context.Context, key int) error {
+	k.mu.Lock()
+	m, ok := k.locks[key]
+	if !ok {
+		m = &refMutex{held: make(chan struct{}, 1)}
+		k.locks[key] = m
+	}
+	m.refs++
+	k.mu.Unlock()
+
+	select {
+	case m.held <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		k.release(key)
+		return ctx.Err()
+	}
+}
+
+func (k *keyedMutex) unlock(key int) {
+	<-k.release(key).held
+}
+
+// release drops a reference to key's mutex, removing it once unused, and
+// returns it
+func (k *keyedMutex) release(key int) *refMutex {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	m := k.locks[key]
+	m.refs--
+	if m.refs == 0 {
+		delete(k.locks, key)
+	}
+	return m
+}
@@ -1,11 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
-	"os"
+	"maps"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -13,14 +24,92 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go/middleware"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
 var (
-	dynamoClient    *dynamodb.Client
-	productsTable   string
-	cartsTable      string
+	dynamoClient         *dynamodb.Client
+	productsTable        string
+	cartsTable           string
+	wishlistsTable       string
+	promosTable          string
+	countersTable        string
+	maxCartItems         int
+	maxItemQuantity      int
+	scanSegments         int
+	cartTTL              time.Duration
+	seedBatchSize        int
+	seedMode             string
+	seedDelay            time.Duration
+	compressDescriptions bool
+	reservationTTL       time.Duration
+	consistentReads      bool
+	dynamoSemaphore      *semaphore.Weighted
 )
 
+// ErrCartFull is returned when adding a new product would exceed the
+// maximum number of distinct line items allowed in a cart
+var ErrCartFull = errors.New("cart has reached the maximum number of distinct items")
+
+// ErrQuantityTooLarge is returned when a line's quantity would exceed
+// MAX_ITEM_QUANTITY
+var ErrQuantityTooLarge = errors.New("item quantity exceeds the maximum")
+
+// ErrCartTooLarge is returned when a cart would exceed DynamoDB's per-item size limit
+var ErrCartTooLarge = errors.New("cart exceeds the DynamoDB item size limit")
+
+// ErrProductNotFound is returned when a product does not exist
+var ErrProductNotFound = errors.New("product not found")
+
+// ErrVersionConflict is returned when a product was edited since the client read it
+var ErrVersionConflict = errors.New("product was modified since it was read")
+
+// ErrInsufficientStock is returned when a stock decrement would go below zero
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// ErrCartNotFound is returned when a customer has no cart
+var ErrCartNotFound = errors.New("cart not found")
+
+// ErrWishlistNotFound is returned when a customer has no wishlist
+var ErrWishlistNotFound = errors.New("wishlist not found")
+
+// ErrWishlistsDisabled is returned by wishlist operations when WISHLISTS_TABLE is not configured
+var ErrWishlistsDisabled = errors.New("wishlists are not configured")
+
+// ErrItemNotInCart is returned when a product is not a line item of the cart
+var ErrItemNotInCart = errors.New("item not found in cart")
+
+// ErrCartConflict is returned when a cart changed concurrently during a conditional write
+var ErrCartConflict = errors.New("cart was modified concurrently")
+
+// ErrCartExists is returned when creating a cart for, or transferring a cart
+// to, a customer who already has a live one
+var ErrCartExists = errors.New("target customer already has a cart")
+
+// ErrPromosDisabled is returned by promo operations when PROMOS_TABLE is not configured
+var ErrPromosDisabled = errors.New("promo codes are not configured")
+
+// ErrPromoNotFound is returned when a promo code does not exist
+var ErrPromoNotFound = errors.New("invalid promo code")
+
+// ErrPromoExpired is returned when a promo code is past its expiry
+var ErrPromoExpired = errors.New("promo code has expired")
+
+// ErrProductUndecodable is returned by GetProducts when a stored product
+// can't be decoded, along with the products that could
+var ErrProductUndecodable = errors.New("product could not be decoded")
+
+// ErrDuplicateSKU is returned when more than one product shares a SKU
+var ErrDuplicateSKU = errors.New("sku is not unique")
+
+// productsSKUIndex is the products GSI keyed on sku (see terraform/modules/dynamodb)
+const productsSKUIndex = "sku-index"
+
+// maxItemSizeBytes is DynamoDB's hard limit for a single item (400KB)
+const maxItemSizeBytes = 400 * 1024
+
 type ProductItem struct {
 	ID           int     `dynamodbav:"product_id"`
 	SKU          string  `dynamodbav:"sku"`
@@ -32,14 +121,86 @@ type ProductItem struct {
 	Category     string  `dynamodbav:"category"`
 	Description  string  `dynamodbav:"description"`
 	Brand        string  `dynamodbav:"brand"`
+	PriceCents   int     `dynamodbav:"price_cents"`
+	Stock        int     `dynamodbav:"stock"`    // available, excluding reserved
+	Reserved     int     `dynamodbav:"reserved"` // held by cart reservations
+	// Version is bumped by every edit of the product's details (not its
+	// stock), for optimistic concurrency, see PatchProduct
+	Version      int     `dynamodbav:"version"`
+	// Stale is set when the product was served from the in-memory catalog
+	// because DynamoDB was unavailable. It is never persisted.
+	Stale        bool    `dynamodbav:"-"`
+	// Unpriced is set when the stored product has no price_cents, e.g. it
+	// was stored before prices existed, so PriceCents' 0 doesn't mean free
+	Unpriced     bool    `dynamodbav:"-"`
+}
+
+
+// ProductPatch holds a partial product update. Nil fields are left untouched,
+// which lets clients set fields to zero values explicitly.
+type ProductPatch struct {
+	SKU          *string  `json:"sku"`
+	Manufacturer *string  `json:"manufacturer"`
+	CategoryID   *int     `json:"category_id"`
+	Weight       *float64 `json:"weight"`
+	SomeOtherID  *int     `json:"some_other_id"`
+	Name         *string  `json:"name"`
+	Category     *string  `json:"category"`
+	Description  *string  `json:"description"`
+	Brand        *string  `json:"brand"`
+	PriceCents   *int     `json:"price_cents"`
+	// Version, when set, is the version the client read: the update fails
+	// with ErrVersionConflict if the product has changed since
+	Version      *int     `json:"version"`
 }
 
+// applyTo sets the patch's non-nil fields on product
+func (p ProductPatch) applyTo(product *ProductItem) {
+	if p.SKU != nil {
+		product.SKU = *p.SKU
+	}
+	if p.Manufacturer != nil {
+		product.Manufacturer = *p.Manufacturer
+	}
+	if p.CategoryID != nil {
+		product.CategoryID = *p.CategoryID
+	}
+	if p.Weight != nil {
+		product.Weight = *p.Weight
+	}
+	if p.SomeOtherID != nil {
+		product.SomeOtherID = *p.SomeOtherID
+	}
+	if p.Name != nil {
+		product.Name = *p.Name
+	}
+	if p.Category != nil {
+		product.Category = *p.Category
+	}
+	if p.Description != nil {
+		product.Description = *p.Description
+	}
+	if p.Brand != nil {
+		product.Brand = *p.Brand
+	}
+	if p.PriceCents != nil {
+		product.PriceCents = *p.PriceCents
+	}
+}
 
 type CartItem struct {
 	CustomerID int           `dynamodbav:"customer_id"`
 	Items      []CartProduct `dynamodbav:"items"`
 	CreatedAt  string        `dynamodbav:"created_at"`
 	UpdatedAt  string        `dynamodbav:"updated_at"`
+	Version    int           `dynamodbav:"version"` // bumped by every write, see cartVersionCondition
+	PromoCode  string        `dynamodbav:"promo_code,omitempty"` // applied promo, see SetCartPromo
+	Name       string        `dynamodbav:"name,omitempty"`       // customer's label, see UpdateCartMetadata
+	Notes      string        `dynamodbav:"notes,omitempty"`
+	// ExpiresAt is the epoch-seconds DynamoDB TTL attribute, refreshed on every
+	// cart write so abandoned carts are eventually deleted. TTL must be enabled
+	// on the carts table for the expires_at attribute (see terraform/modules/dynamodb).
+	ExpiresAt  int64         `dynamodbav:"expires_at,omitempty"`
 }
 
 type CartProduct struct {
@@ -54,6 +215,14 @@ type CartProduct struct {
 	// Description  string  `dynamodbav:"description"`
 	// Brand        string  `dynamodbav:"brand"`
 	Quantity     int     `dynamodbav:"quantity"`
+	// Reserved is the quantity of stock held for this line until
+	// ReservedUntil (epoch seconds), see reservations.go
+	Reserved      int   `dynamodbav:"reserved,omitempty"`
+	ReservedUntil int64 `dynamodbav:"reserved_until,omitempty"`
+	// PriceCents is the product's price when the line was last added to,
+	// so validation can report price changes. Nil for unpriced products and
+	// lines written before prices were recorded, e.g. moved from a wishlist.
+	PriceCents *int `dynamodbav:"price_cents,omitempty"`
 }
 
 type CustomerItem struct {
@@ -63,40 +232,117 @@ type CustomerItem struct {
 	CreatedAt  string `dynamodbav:"created_at"`
 }
 
-// InitDynamoDB initializes the DynamoDB client and table names
-func InitDynamoDB() error {
+// InitDynamoDB initializes the DynamoDB client and table names from the loaded config
+func InitDynamoDB(appConfig *Config) error {
 	ctx := context.Background()
 
 	// Load AWS configuration
 	cfg, err := config.LoadDefaultConfig(ctx,
-		config.WithRegion(os.Getenv("AWS_REGION")),
+		config.WithRegion(appConfig.AWSRegion),
 	)
 	if err != nil {
 		return fmt.Errorf("unable to load SDK config: %v", err)
 	}
 
-	dynamoClient = dynamodb.NewFromConfig(cfg)
+	// Bound in-flight DynamoDB operations to smooth load and avoid throttling cascades
+	dynamoSemaphore = semaphore.NewWeighted(int64(appConfig.DynamoMaxConcurrency))
+
+	dynamoClient = dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		o.APIOptions = append(o.APIOptions, dynamoTracingMiddleware, concurrencyLimitMiddleware, callCounterMiddleware)
+	})
+
+	productsTable = appConfig.ProductsTable
+	cartsTable = appConfig.CartsTable
 
-	// Get table names from environment
-	productsTable = os.Getenv("PRODUCTS_TABLE")
-	cartsTable = os.Getenv("CARTS_TABLE")
+	// Wishlists are optional, their endpoints return 503 when no table is configured
+	wishlistsTable = appConfig.WishlistsTable
+	if wishlistsTable == "" {
+		log.Println("WISHLISTS_TABLE not set, wishlists disabled")
+	}
+
+	// So are promo codes
+	promosTable = appConfig.PromosTable
+	if promosTable == "" {
+		log.Println("PROMOS_TABLE not set, promo codes disabled")
+	}
 
-	if productsTable == "" || cartsTable == "" {
-		return fmt.Errorf("table names not set in environment variables")
+	// New product IDs come from an atomic counter when there is a table for it
+	countersTable = appConfig.CountersTable
+	if countersTable == "" {
+		log.Println("COUNTERS_TABLE not set, new product IDs are found by scanning products")
 	}
 
-	log.Printf("DynamoDB initialized with tables: %s, %s", 
-		productsTable, cartsTable)
+	// Abandoned carts expire after CartTTL without writes
+	cartTTL = appConfig.CartTTL
+
+	// Cap distinct line items per cart to keep the cart item well below 400KB
+	maxCartItems = appConfig.MaxCartItems
+	maxItemQuantity = appConfig.MaxItemQuantity
+
+	compressDescriptions = appConfig.CompressDescriptions
+
+	// Full-table scans are split into this many parallel segments
+	scanSegments = appConfig.ScanSegments
+
+	// Stock is reserved for cart lines for ReservationTTL, 0 disables reservations
+	reservationTTL = appConfig.ReservationTTL
+
+	// Strongly consistent reads cost twice the read capacity of eventually
+	// consistent ones, so they are off unless DYNAMO_CONSISTENT_READS is set
+	consistentReads = appConfig.ConsistentReads
+
+	seedBatchSize = appConfig.SeedBatchSize
+	seedMode = appConfig.SeedMode
+	seedDelay = appConfig.SeedDelay
+
+	log.Printf("DynamoDB initialized with tables: %s, %s (max %d concurrent calls)", 
+		productsTable, cartsTable, appConfig.DynamoMaxConcurrency)
 
 	return nil
 }
 
-// GetProduct retrieves a product by ID
-func GetProduct(productID int) (*ProductItem, error) {
-	ctx := context.Background()
+// concurrencyLimitMiddleware registers a middleware that acquires a slot of
+// dynamoSemaphore before every DynamoDB operation (including SDK retries)
+// and releases it when the operation returns
+func concurrencyLimitMiddleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("ConcurrencyLimit",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			if err := dynamoSemaphore.Acquire(ctx, 1); err != nil {
+				return middleware.InitializeOutput{}, middleware.Metadata{}, fmt.Errorf("waiting for DynamoDB concurrency slot: %w", err)
+			}
+			defer dynamoSemaphore.Release(1)
+			return next.HandleInitialize(ctx, in)
+		}), middleware.Before)
+}
+
+// dynamoCallsKey is the context key of the per-request DynamoDB call counter
+type dynamoCallsKey struct{}
+
+// withDynamoCallCounter returns a context that counts the DynamoDB operations
+// made with it, and the counter itself
+func withDynamoCallCounter(ctx context.Context) (context.Context, *atomic.Int64) {
+	counter := &atomic.Int64{}
+	return context.WithValue(ctx, dynamoCallsKey{}, counter), counter
+}
 
+// callCounterMiddleware registers a middleware that increments the context's
+// call counter (if any) once per DynamoDB operation
+func callCounterMiddleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("CallCounter",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			if counter, ok := ctx.Value(dynamoCallsKey{}).(*atomic.Int64); ok {
+				counter.Add(1)
+			}
+			return next.HandleInitialize(ctx, in)
+		}), middleware.Before)
+}
+
+// GetProduct retrieves a product by ID. Read-only endpoints that can live
+// with stale data use GetProductAllowStale instead.
+func GetProduct(ctx context.Context, productID int) (*ProductItem, error) {
 	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: aws.String(productsTable),
+		TableName:      aws.String(productsTable),
+		ConsistentRead: aws.Bool(consistentReads),
 		Key: map[string]types.AttributeValue{
 			"product_id": &types.AttributeValueMemberN{Value: strconv.Itoa(productID)},
 		},
@@ -106,184 +352,2643 @@ func GetProduct(productID int) (*ProductItem, error) {
 	}
 
 	if result.Item == nil {
-		return nil, fmt.Errorf("product not found")
+		return nil, ErrProductNotFound
 	}
 
-	var product ProductItem
-	err = attributevalue.UnmarshalMap(result.Item, &product)
+	product, err := unmarshalProduct(result.Item)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal product: %v", err)
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// marshalProduct converts a product to its DynamoDB item. When
+// COMPRESS_DESCRIPTIONS is enabled the description is stored gzipped as a
+// binary attribute instead of a string.
+func marshalProduct(product ProductItem) (map[string]types.AttributeValue, error) {
+	item, err := attributevalue.MarshalMap(product)
+	if err != nil {
+		return nil, err
+	}
+	if compressDescriptions {
+		if description, ok := item["description"]; ok {
+			if item["description"], err = compressAttribute(description); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return item, nil
+}
+
+// unmarshalProduct converts a DynamoDB item to a product, transparently
+// decompressing binary descriptions. Uncompressed string descriptions are
+// read as-is, so both formats can coexist in the table.
+func unmarshalProduct(item map[string]types.AttributeValue) (*ProductItem, error) {
+	if compressed, ok := item["description"].(*types.AttributeValueMemberB); ok {
+		reader, err := gzip.NewReader(bytes.NewReader(compressed.Value))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress description: %v", err)
+		}
+		description, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress description: %v", err)
+		}
+
+		// Copy the map so the caller's item isn't modified
+		item = maps.Clone(item)
+		item["description"] = &types.AttributeValueMemberS{Value: string(description)}
 	}
 
+	var product ProductItem
+	if err := attributevalue.UnmarshalMap(item, &product); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal product: %v", err)
+	}
+	_, priced := item["price_cents"]
+	product.Unpriced = !priced
 	return &product, nil
 }
 
+// compressAttribute gzips a string attribute value into a binary one
+func compressAttribute(value types.AttributeValue) (types.AttributeValue, error) {
+	text, ok := value.(*types.AttributeValueMemberS)
+	if !ok {
+		return value, nil
+	}
 
-// GetCart retrieves a customer's cart
-func GetCart(customerID int) (*CartItem, error) {
-	ctx := context.Background()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(text.Value)); err != nil {
+		return nil, fmt.Errorf("failed to compress description: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress description: %v", err)
+	}
+	return &types.AttributeValueMemberB{Value: buf.Bytes()}, nil
+}
 
-	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: aws.String(cartsTable),
-		Key: map[string]types.AttributeValue{
-			"customer_id": &types.AttributeValueMemberN{Value: strconv.Itoa(customerID)},
+// GetProductBySKU looks a product up through the sku GSI. GSIs are
+// eventually consistent, so a just-written product may briefly be missing.
+// If several products share the SKU the first match is returned together
+// with ErrDuplicateSKU.
+func GetProductBySKU(ctx context.Context, sku string) (*ProductItem, error) {
+	// No ConsistentRead here: GSI queries are always eventually consistent
+	result, err := dynamoClient.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(productsTable),
+		IndexName:              aws.String(productsSKUIndex),
+		KeyConditionExpression: aws.String("sku = :sku"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":sku": &types.AttributeValueMemberS{Value: sku},
 		},
+		// One extra item is enough to detect duplicates
+		Limit: aws.Int32(2),
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get cart: %v", err)
+		return nil, fmt.Errorf("failed to query product by sku: %v", err)
+	}
+	if len(result.Items) == 0 {
+		return nil, ErrProductNotFound
 	}
 
-	if result.Item == nil {
-		// Cart not found in DynamoDB - return error instead of empty cart
-		return nil, fmt.Errorf("cart not found for customer %d", customerID)
+	product, err := unmarshalProduct(result.Items[0])
+	if err != nil {
+		return nil, err
 	}
+	if len(result.Items) > 1 {
+		return product, fmt.Errorf("%w: %s", ErrDuplicateSKU, sku)
+	}
+	return product, nil
+}
 
-	var cart CartItem
-	err = attributevalue.UnmarshalMap(result.Item, &cart)
+// UpdateProductStock adjusts a product's stock without touching its other
+// fields. With set == false the stock is changed by amount (which may be
+// negative) and the conditional update guarantees it never goes below zero.
+// With set == true the stock is replaced by amount. Returns the new stock.
+func UpdateProductStock(ctx context.Context, productID, amount int, set bool) (int, error) {
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(productsTable),
+		Key: map[string]types.AttributeValue{
+			"product_id": &types.AttributeValueMemberN{Value: strconv.Itoa(productID)},
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":amount": &types.AttributeValueMemberN{Value: strconv.Itoa(amount)},
+		},
+		ReturnValues:                        types.ReturnValueUpdatedNew,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	}
+
+	switch {
+	case set:
+		input.UpdateExpression = aws.String("SET stock = :amount")
+		input.ConditionExpression = aws.String("attribute_exists(product_id)")
+	case amount < 0:
+		input.UpdateExpression = aws.String("SET stock = stock + :amount")
+		input.ConditionExpression = aws.String("attribute_exists(product_id) AND stock >= :needed")
+		input.ExpressionAttributeValues[":needed"] = &types.AttributeValueMemberN{Value: strconv.Itoa(-amount)}
+	default:
+		input.UpdateExpression = aws.String("SET stock = if_not_exists(stock, :zero) + :amount")
+		input.ConditionExpression = aws.String("attribute_exists(product_id)")
+		input.ExpressionAttributeValues[":zero"] = &types.AttributeValueMemberN{Value: "0"}
+	}
+
+	result, err := dynamoClient.UpdateItem(ctx, input)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal cart: %v", err)
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			// No old item means the product doesn't exist, otherwise stock was too low
+			if failed.Item == nil {
+				return 0, ErrProductNotFound
+			}
+			return 0, ErrInsufficientStock
+		}
+		return 0, fmt.Errorf("failed to update stock: %v", err)
 	}
 
-	return &cart, nil
+	var updated struct {
+		Stock int `dynamodbav:"stock"`
+	}
+	if err := attributevalue.UnmarshalMap(result.Attributes, &updated); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal stock: %v", err)
+	}
+
+	return updated.Stock, nil
 }
 
-// AddToCart adds a product to the customer's cart
-func AddToCart(customerID, productID, quantity int) error {
-	ctx := context.Background()
+// PatchProduct updates only the fields set in patch using a dynamically built
+// UpdateExpression and returns the full updated product. The product's
+// version is incremented; if patch.Version is set the update is conditioned
+// on the stored version matching it (products stored before versioning count
+// as version 0) and fails with ErrVersionConflict otherwise.
+func PatchProduct(ctx context.Context, productID int, patch ProductPatch) (*ProductItem, error) {
+	fields := map[string]any{}
+	if patch.SKU != nil {
+		fields["sku"] = *patch.SKU
+	}
+	if patch.Manufacturer != nil {
+		fields["manufacturer"] = *patch.Manufacturer
+	}
+	if patch.CategoryID != nil {
+		fields["category_id"] = *patch.CategoryID
+	}
+	if patch.Weight != nil {
+		fields["weight"] = *patch.Weight
+	}
+	if patch.SomeOtherID != nil {
+		fields["some_other_id"] = *patch.SomeOtherID
+	}
+	if patch.Name != nil {
+		fields["name"] = *patch.Name
+	}
+	if patch.Category != nil {
+		fields["category"] = *patch.Category
+	}
+	if patch.Description != nil {
+		fields["description"] = *patch.Description
+	}
+	if patch.Brand != nil {
+		fields["brand"] = *patch.Brand
+	}
+	if patch.PriceCents != nil {
+		fields["price_cents"] = *patch.PriceCents
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields to update")
+	}
 
-	// Get product details
-	product, err := GetProduct(productID)
-	if err != nil {
-		return fmt.Errorf("product not found: %v", err)
+	// Placeholders for names too, since "name" is a DynamoDB reserved word
+	names := make(map[string]string, len(fields))
+	values := make(map[string]types.AttributeValue, len(fields))
+	assignments := make([]string, 0, len(fields))
+	for attr, value := range fields {
+		av, err := attributevalue.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s: %v", attr, err)
+		}
+		if attr == "description" && compressDescriptions {
+			if av, err = compressAttribute(av); err != nil {
+				return nil, err
+			}
+		}
+		names["#"+attr] = attr
+		values[":"+attr] = av
+		assignments = append(assignments, fmt.Sprintf("#%s = :%s", attr, attr))
 	}
+	sort.Strings(assignments)
 
-	// Get existing cart
-	cart, err := GetCart(customerID)
-	if err != nil {
-		return fmt.Errorf("failed to get cart: %v", err)
+	names["#version"] = "version"
+	values[":zero"] = &types.AttributeValueMemberN{Value: "0"}
+	values[":one"] = &types.AttributeValueMemberN{Value: "1"}
+	assignments = append(assignments, "#version = if_not_exists(#version, :zero) + :one")
+
+	condition := "attribute_exists(product_id)"
+	if patch.Version != nil {
+		values[":expected"] = &types.AttributeValueMemberN{Value: strconv.Itoa(*patch.Version)}
+		if *patch.Version == 0 {
+			condition += " AND (attribute_not_exists(#version) OR #version = :expected)"
+		} else {
+			condition += " AND #version = :expected"
+		}
 	}
 
-	// Check if product already in cart
-	found := false
-	for i, item := range cart.Items {
-		if item.ID == productID {
-			cart.Items[i].Quantity += quantity
-			found = true
-			break
+	result, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(productsTable),
+		Key: map[string]types.AttributeValue{
+			"product_id": &types.AttributeValueMemberN{Value: strconv.Itoa(productID)},
+		},
+		UpdateExpression:          aws.String("SET " + strings.Join(assignments, ", ")),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnValues:              types.ReturnValueAllNew,
+		// The old item tells a version mismatch apart from a missing product
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			if failed.Item == nil {
+				return nil, ErrProductNotFound
+			}
+			var current struct {
+				Version int `dynamodbav:"version"`
+			}
+			_ = attributevalue.UnmarshalMap(failed.Item, &current)
+			return nil, fmt.Errorf("%w: expected version %d, current version %d", ErrVersionConflict, *patch.Version, current.Version)
 		}
+		return nil, fmt.Errorf("failed to update product: %v", err)
 	}
 
-	// Add new item if not found
-	if !found {
-		cart.Items = append(cart.Items, CartProduct{
-			ID:           product.ID,
-			// SKU:          product.SKU,
-			Manufacturer: product.Manufacturer,
-			// CategoryID:   product.CategoryID,
-			// Weight:       product.Weight,
-			// SomeOtherID:  product.SomeOtherID,
-			// Name:         product.Name,
-			Category:     product.Category,
-			// Description:  product.Description,
-			// Brand:        product.Brand,
-			Quantity:     quantity,
+	return unmarshalProduct(result.Attributes)
+}
+
+// ReplaceProduct overwrites all of a product's details (everything but its
+// ID, stock and reservations) if it is still at expectedVersion, see PatchProduct
+func ReplaceProduct(ctx context.Context, product ProductItem, expectedVersion int) (*ProductItem, error) {
+	return PatchProduct(ctx, product.ID, ProductPatch{
+		SKU:          &product.SKU,
+		Manufacturer: &product.Manufacturer,
+		CategoryID:   &product.CategoryID,
+		Weight:       &product.Weight,
+		SomeOtherID:  &product.SomeOtherID,
+		Name:         &product.Name,
+		Category:     &product.Category,
+		Description:  &product.Description,
+		Brand:        &product.Brand,
+		PriceCents:   &product.PriceCents,
+		Version:      &expectedVersion,
+	})
+}
+
+// maxProductIDAttempts bounds how many IDs CreateProduct tries before giving up
+const maxProductIDAttempts = 5
+
+// CreateProduct stores product under a new ID from nextProductID. The put is
+// still conditional, so an ID that turns out to be taken (e.g. by products
+// seeded after the counter was initialized) is skipped rather than
+// overwritten.
+func CreateProduct(ctx context.Context, product ProductItem) (*ProductItem, error) {
+	for attempt := 1; ; attempt++ {
+		id, err := nextProductID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		product.ID = id
+
+		item, err := marshalProduct(product)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal product: %v", err)
+		}
+
+		_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:           aws.String(productsTable),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(product_id)"),
 		})
+		if err == nil {
+			return &product, nil
+		}
+		var failed *types.ConditionalCheckFailedException
+		if !errors.As(err, &failed) {
+			return nil, fmt.Errorf("failed to create product: %v", err)
+		}
+		if attempt == maxProductIDAttempts {
+			return nil, fmt.Errorf("failed to create product: IDs up to %d are already taken", product.ID)
+		}
 	}
+}
 
-	cart.UpdatedAt = time.Now().Format(time.RFC3339)
+// productIDCounter names the counters table item that holds the last
+// product ID handed out
+const productIDCounter = "product_id"
 
-	// Marshal cart to DynamoDB format
-	item, err := attributevalue.MarshalMap(cart)
+// nextProductID returns an unused product ID. With a counters table it is
+// taken from an atomic counter, so concurrent creates on any instance get
+// different IDs and deleted IDs are never handed out again; the counter
+// starts from the highest stored ID on first use. Without one it is one past
+// the highest ID stored, which costs a scan of the products table.
+func nextProductID(ctx context.Context) (int, error) {
+	if countersTable == "" {
+		highest, err := highestProductID(ctx)
+		if err != nil {
+			return 0, err
+		}
+		return highest + 1, nil
+	}
+
+	result, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(countersTable),
+		Key: map[string]types.AttributeValue{
+			"name": &types.AttributeValueMemberS{Value: productIDCounter},
+		},
+		UpdateExpression:         aws.String("ADD #value :one"),
+		ConditionExpression:      aws.String("attribute_exists(#value)"),
+		ExpressionAttributeNames: map[string]string{"#value": "value"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one": &types.AttributeValueMemberN{Value: "1"},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	var failed *types.ConditionalCheckFailedException
+	if errors.As(err, &failed) {
+		return initProductIDCounter(ctx)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to marshal cart: %v", err)
+		return 0, fmt.Errorf("failed to allocate product ID: %v", err)
 	}
+	return counterValue(result.Attributes)
+}
 
-	// Put cart back to DynamoDB
+// initProductIDCounter creates the product ID counter one past the highest
+// stored ID and returns that ID. If another instance creates it first, the
+// ID is taken from the counter it created instead.
+func initProductIDCounter(ctx context.Context) (int, error) {
+	highest, err := highestProductID(ctx)
+	if err != nil {
+		return 0, err
+	}
 	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: aws.String(cartsTable),
-		Item:      item,
+		TableName: aws.String(countersTable),
+		Item: map[string]types.AttributeValue{
+			"name":  &types.AttributeValueMemberS{Value: productIDCounter},
+			"value": &types.AttributeValueMemberN{Value: strconv.Itoa(highest + 1)},
+		},
+		ConditionExpression:      aws.String("attribute_not_exists(#name)"),
+		ExpressionAttributeNames: map[string]string{"#name": "name"},
 	})
+	var failed *types.ConditionalCheckFailedException
+	if errors.As(err, &failed) {
+		return nextProductID(ctx)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to update cart: %v", err)
+		return 0, fmt.Errorf("failed to create product ID counter: %v", err)
 	}
+	return highest + 1, nil
+}
 
-	return nil
+// counterValue reads the value attribute of a counters table item
+func counterValue(attributes map[string]types.AttributeValue) (int, error) {
+	value, ok := attributes["value"].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, errors.New("counter has no numeric value")
+	}
+	return strconv.Atoi(value.Value)
 }
 
-// SeedData populates DynamoDB with sample data using your existing GenerateProducts function
-func SeedData(productsMap map[int]Item) error {
-	ctx := context.Background()
+// highestProductID is the highest product ID stored in DynamoDB, or 0
+func highestProductID(ctx context.Context) (int, error) {
+	ids, err := existingProductIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	highest := 0
+	for id := range ids {
+		highest = max(highest, id)
+	}
+	return highest, nil
+}
 
-	log.Println("Seeding DynamoDB tables...")
+// maxPriceUpdateWorkers bounds the concurrent UpdateItem calls of one UpdatePrices
+const maxPriceUpdateWorkers = 10
 
-	
-	log.Printf("Starting batch write to DynamoDB...")
+// PriceUpdate sets one product's price. PriceCents is a pointer so that an
+// entry missing it is rejected rather than making the product free.
+type PriceUpdate struct {
+	ProductID  int  `json:"product_id"`
+	PriceCents *int `json:"price_cents" binding:"required"`
+}
 
-	// Convert map to slice and batch write (max 25 items per batch)
-	batchCount := 0
-	writeRequests := make([]types.WriteRequest, 0, 25)
-	
-	for _, product := range productsMap {
-		// Convert Item struct to DynamoDB ProductItem format (same structure, just with dynamodb tags)
-		dynamoProduct := ProductItem{
-			ID:           product.ID,
-			SKU:          product.SKU,
-			Manufacturer: product.Manufacturer,
-			CategoryID:   product.CategoryID,
-			Weight:       product.Weight,
-			SomeOtherID:  product.SomeOtherID,
-			Name:         product.Name,
-			Category:     product.Category,
-			Description:  product.Description,
-			Brand:        product.Brand,
+// PriceUpdateResult is the outcome of one PriceUpdate
+type PriceUpdateResult struct {
+	ProductID  int          `json:"product_id"`
+	PriceCents int          `json:"price_cents"`
+	Success    bool         `json:"success"`
+	Error      string       `json:"error,omitempty"`
+	Product    *ProductItem `json:"-"` // the updated product on success
+}
+
+// UpdatePrices applies each price update with its own conditional UpdateItem
+// (see PatchProduct), several at a time, so one missing product doesn't fail
+// the others. Results are in the order of updates. Unlike a full replace
+// there is no version check: only price_cents is written, so concurrent edits
+// of other fields aren't lost.
+func UpdatePrices(ctx context.Context, updates []PriceUpdate) []PriceUpdateResult {
+	results := make([]PriceUpdateResult, len(updates))
+	workers := semaphore.NewWeighted(maxPriceUpdateWorkers)
+	var wg sync.WaitGroup
+
+	for i, update := range updates {
+		results[i] = PriceUpdateResult{ProductID: update.ProductID, PriceCents: *update.PriceCents}
+		if err := workers.Acquire(ctx, 1); err != nil {
+			results[i].Error = err.Error()
+			continue
 		}
-		
-		item, err := attributevalue.MarshalMap(dynamoProduct)
+		wg.Add(1)
+		go func(result *PriceUpdateResult) {
+			defer wg.Done()
+			defer workers.Release(1)
+
+			price := result.PriceCents
+			product, err := PatchProduct(ctx, result.ProductID, ProductPatch{PriceCents: &price})
+			if err != nil {
+				result.Error = err.Error()
+				return
+			}
+			result.Success = true
+			result.Product = product
+		}(&results[i])
+	}
+
+	wg.Wait()
+	return results
+}
+
+// DeleteProducts deletes the given products with BatchWriteItem in chunks of
+// 25 (DynamoDB's limit), retrying unprocessed deletes with backoff. A delete
+// request doesn't say whether the item existed, so the products are looked
+// up first and those that don't exist are returned as notFound instead.
+func DeleteProducts(ctx context.Context, productIDs []int) (deleted, notFound []int, err error) {
+	items, err := batchGetByIntKey(ctx, productsTable, "product_id", productIDs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to look up products: %v", err)
+	}
+	existing := make(map[int]bool, len(items))
+	for _, item := range items {
+		product, err := unmarshalProduct(item)
 		if err != nil {
-			log.Printf("Warning: failed to marshal product %d: %v", product.ID, err)
-			continue
+			return nil, nil, err
 		}
+		existing[product.ID] = true
+	}
 
-		writeRequests = append(writeRequests, types.WriteRequest{
-			PutRequest: &types.PutRequest{
-				Item: item,
-			},
-		})
+	seen := make(map[int]bool, len(productIDs))
+	var toDelete []int
+	for _, id := range productIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if existing[id] {
+			toDelete = append(toDelete, id)
+		} else {
+			notFound = append(notFound, id)
+		}
+	}
 
-		// When we have 25 items, write the batch
-		if len(writeRequests) == 25 {
-			_, err := dynamoClient.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
-				RequestItems: map[string][]types.WriteRequest{
-					productsTable: writeRequests,
+	for start := 0; start < len(toDelete); start += 25 {
+		chunk := toDelete[start:min(start+25, len(toDelete))]
+		requests := make([]types.WriteRequest, 0, len(chunk))
+		for _, id := range chunk {
+			requests = append(requests, types.WriteRequest{
+				DeleteRequest: &types.DeleteRequest{
+					Key: map[string]types.AttributeValue{
+						"product_id": &types.AttributeValueMemberN{Value: strconv.Itoa(id)},
+					},
 				},
 			})
-			if err != nil {
-				log.Printf("Warning: failed to batch write products: %v", err)
+		}
+		pending := map[string][]types.WriteRequest{productsTable: requests}
+
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt > 0 {
+				if attempt > 5 {
+					return deleted, notFound, fmt.Errorf("unprocessed deletes remain in %s after retries", productsTable)
+				}
+				select {
+				case <-time.After(time.Duration(attempt*50) * time.Millisecond):
+				case <-ctx.Done():
+					return deleted, notFound, ctx.Err()
+				}
 			}
-			
-			batchCount++
-			if batchCount%100 == 0 {
-				log.Printf("Seeded %d products...", batchCount*25)
+
+			result, err := dynamoClient.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
+				RequestItems: pending,
+			})
+			if err != nil {
+				return deleted, notFound, fmt.Errorf("failed to delete products: %v", err)
 			}
-			
-			// Reset for next batch
-			writeRequests = make([]types.WriteRequest, 0, 25)
+			pending = result.UnprocessedItems
 		}
+
+		deleted = append(deleted, chunk...)
 	}
-	
-	// Write any remaining items
-	if len(writeRequests) > 0 {
-		_, err := dynamoClient.BatchWriteItem(ctx, &dynamodb.BatchWriteItemInput{
-			RequestItems: map[string][]types.WriteRequest{
-				productsTable: writeRequests,
-			},
-		})
-		if err != nil {
-			log.Printf("Warning: failed to batch write final products: %v", err)
+
+	return deleted, notFound, nil
+}
+
+// GetProductAllowStale is GetProduct for read-only endpoints: if DynamoDB
+// errors, the product is served from the in-memory syncProducts catalog
+// instead and marked Stale. This keeps reads available during a DynamoDB
+// outage at the cost of consistency: the in-memory copy may miss edits made
+// through other instances, and stock may be out of date. Writes and
+// validation must not act on it, so they use GetProduct. A "not found"
+// answer from DynamoDB is authoritative and never falls back.
+func GetProductAllowStale(ctx context.Context, productID int) (*ProductItem, error) {
+	product, err := GetProduct(ctx, productID)
+	if err != nil && !errors.Is(err, ErrProductNotFound) {
+		if cached, ok := cachedProduct(productID); ok {
+			log.Printf("Warning: DynamoDB unavailable, serving product %d from memory: %v", productID, err)
+			return cached, nil
 		}
-		batchCount++
 	}
+	return product, err
+}
 
-	log.Printf("Database seeding completed! Seeded %d products in %d batches", len(productsMap), batchCount)
-	return nil
-}
\ No newline at end of file
+// cachedProduct looks a product up in the in-memory catalog, marked as stale
+func cachedProduct(productID int) (*ProductItem, bool) {
+	value, exists := syncProducts.Load(productID)
+	if !exists {
+		return nil, false
+	}
+	product := productItemFromItem(value.(Item))
+	product.Stale = true
+	return &product, true
+}
+
+// productItemFromItem converts an API Item into its DynamoDB representation
+func productItemFromItem(item Item) ProductItem {
+	return ProductItem{
+		ID:           item.ID,
+		SKU:          item.SKU,
+		Manufacturer: item.Manufacturer,
+		CategoryID:   item.CategoryID,
+		Weight:       item.Weight,
+		SomeOtherID:  item.SomeOtherID,
+		Name:         item.Name,
+		Category:     item.Category,
+		Description:  item.Description,
+		Brand:        item.Brand,
+		PriceCents:   item.PriceCents,
+		Stock:        item.Stock,
+		Reserved:     item.Reserved,
+		Version:      item.Version,
+	}
+}
+
+// sampleSegments is the number of Scan segments SampleProducts picks from
+const sampleSegments = 16
+
+// SampleProducts returns up to limit products, paging through Scan segments
+// in random order so repeated samples cover different parts of the table
+func SampleProducts(ctx context.Context, limit int) ([]ProductItem, error) {
+	products := make([]ProductItem, 0, limit)
+	for _, segment := range rand.Perm(sampleSegments) {
+		paginator := dynamodb.NewScanPaginator(dynamoClient, &dynamodb.ScanInput{
+			TableName:     aws.String(productsTable),
+			Segment:       aws.Int32(int32(segment)),
+			TotalSegments: aws.Int32(sampleSegments),
+			Limit:         aws.Int32(int32(limit)),
+		})
+		for paginator.HasMorePages() && len(products) < limit {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to scan products: %v", err)
+			}
+			for _, item := range page.Items {
+				if len(products) == limit {
+					break
+				}
+				product, err := unmarshalProduct(item)
+				if err != nil {
+					return nil, err
+				}
+				products = append(products, *product)
+			}
+		}
+		if len(products) == limit {
+			break
+		}
+	}
+
+	return products, nil
+}
+
+// ProductPopularity is the add-to-cart count of a product
+type ProductPopularity struct {
+	ProductID  int   `dynamodbav:"product_id"`
+	Popularity int64 `dynamodbav:"popularity"`
+}
+
+// CartProductStats counts the carts holding one product, split by whether
+// the cart is live or expired (abandoned, awaiting deletion by DynamoDB TTL)
+type CartProductStats struct {
+	LiveCarts         int `json:"live_carts"`
+	AbandonedCarts    int `json:"abandoned_carts"`
+	AbandonedQuantity int `json:"abandoned_quantity"`
+}
+
+// ScanCartProductStats scans the whole carts table (see ParallelScan) and
+// counts, per product, the live and expired carts holding it. Expired carts
+// only stay visible until TTL deletes them, typically within a few days.
+func ScanCartProductStats(ctx context.Context) (map[int]*CartProductStats, error) {
+	input := &dynamodb.ScanInput{
+		TableName:            aws.String(cartsTable),
+		ProjectionExpression: aws.String("#items, expires_at"),
+		// "items" is a DynamoDB reserved word
+		ExpressionAttributeNames: map[string]string{"#items": "items"},
+	}
+
+	now := time.Now().Unix()
+	stats := make(map[int]*CartProductStats)
+	err := ParallelScan(ctx, input, scanSegments, func(items []map[string]types.AttributeValue) error {
+		var carts []CartItem
+		if err := attributevalue.UnmarshalListOfMaps(items, &carts); err != nil {
+			return fmt.Errorf("failed to unmarshal carts: %v", err)
+		}
+		for _, cart := range carts {
+			abandoned := cart.ExpiresAt != 0 && now >= cart.ExpiresAt
+			for _, line := range cart.Items {
+				entry := stats[line.ID]
+				if entry == nil {
+					entry = &CartProductStats{}
+					stats[line.ID] = entry
+				}
+				if abandoned {
+					entry.AbandonedCarts++
+					entry.AbandonedQuantity += line.Quantity
+				} else {
+					entry.LiveCarts++
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan carts: %v", err)
+	}
+	return stats, nil
+}
+
+// healthProbeProductID is a product ID that is never assigned, read by
+// PingDynamoDB so the probe stays tiny no matter what the catalog holds
+const healthProbeProductID = 0
+
+// PingDynamoDB times a GetItem of a key that doesn't exist, as a lightweight
+// measure of DynamoDB round-trip latency
+func PingDynamoDB(ctx context.Context) (time.Duration, error) {
+	start := time.Now()
+	_, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(productsTable),
+		Key: map[string]types.AttributeValue{
+			"product_id": &types.AttributeValueMemberN{Value: strconv.Itoa(healthProbeProductID)},
+		},
+		ProjectionExpression: aws.String("product_id"),
+	})
+	latency := time.Since(start)
+	if err != nil {
+		return latency, fmt.Errorf("failed to reach DynamoDB: %v", err)
+	}
+	return latency, nil
+}
+
+// IncrementPopularity atomically adds one to a product's popularity counter
+func IncrementPopularity(ctx context.Context, productID int) error {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(productsTable),
+		Key: map[string]types.AttributeValue{
+			"product_id": &types.AttributeValueMemberN{Value: strconv.Itoa(productID)},
+		},
+		UpdateExpression:    aws.String("ADD popularity :one"),
+		ConditionExpression: aws.String("attribute_exists(product_id)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one": &types.AttributeValueMemberN{Value: "1"},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to increment popularity: %v", err)
+	}
+	return nil
+}
+
+// ParallelScan scans a whole table as totalSegments segments, each read by
+// its own goroutine, and calls fn with every page of items. input sets the
+// table and any projection or filter; its Segment, TotalSegments and
+// ExclusiveStartKey are set per segment. Calls to fn are serialized, so it
+// can aggregate into plain variables. The first error from a scan or from fn
+// stops the remaining segments and is returned.
+func ParallelScan(ctx context.Context, input *dynamodb.ScanInput, totalSegments int, fn func(items []map[string]types.AttributeValue) error) error {
+	group, ctx := errgroup.WithContext(ctx)
+	var mu sync.Mutex
+
+	for segment := range totalSegments {
+		segmentInput := *input
+		segmentInput.Segment = aws.Int32(int32(segment))
+		segmentInput.TotalSegments = aws.Int32(int32(totalSegments))
+
+		group.Go(func() error {
+			paginator := dynamodb.NewScanPaginator(dynamoClient, &segmentInput)
+			for paginator.HasMorePages() {
+				page, err := paginator.NextPage(ctx)
+				if err != nil {
+					return fmt.Errorf("segment %d of %d: %v", segment, totalSegments, err)
+				}
+				mu.Lock()
+				err = fn(page.Items)
+				mu.Unlock()
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	return group.Wait()
+}
+
+// ScanPopularity reads the popularity counter of every product that has one,
+// sorted by popularity descending (ties by product ID).
+//
+// DynamoDB can't sort a table by a non-key attribute, so the ranking is built
+// from a full (projected) scan. That's too expensive per request, so callers
+// refresh an in-memory ranking periodically instead. At larger scale a GSI with
+// a constant partition key and popularity as sort key would allow a Query.
+func ScanPopularity(ctx context.Context) ([]ProductPopularity, error) {
+	input := &dynamodb.ScanInput{
+		TableName:            aws.String(productsTable),
+		ProjectionExpression: aws.String("product_id, popularity"),
+		FilterExpression:     aws.String("popularity > :zero"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":zero": &types.AttributeValueMemberN{Value: "0"},
+		},
+	}
+
+	var ranking []ProductPopularity
+	err := ParallelScan(ctx, input, scanSegments, func(items []map[string]types.AttributeValue) error {
+		var entries []ProductPopularity
+		if err := attributevalue.UnmarshalListOfMaps(items, &entries); err != nil {
+			return fmt.Errorf("failed to unmarshal popularity: %v", err)
+		}
+		ranking = append(ranking, entries...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan popularity: %v", err)
+	}
+
+	sort.Slice(ranking, func(i, j int) bool {
+		if ranking[i].Popularity != ranking[j].Popularity {
+			return ranking[i].Popularity > ranking[j].Popularity
+		}
+		return ranking[i].ProductID < ranking[j].ProductID
+	})
+	return ranking, nil
+}
+
+// BrandCount is the number of products of a brand
+type BrandCount struct {
+	Brand string `json:"brand"`
+	Count int    `json:"count"`
+}
+
+// CatalogFacets are the distinct categories and brands of the products table
+type CatalogFacets struct {
+	Categories []string     // sorted
+	Brands     []BrandCount // by count descending, then brand
+}
+
+// ScanCatalogFacets computes the distinct product categories and the product
+// count of every brand. DynamoDB has no DISTINCT or GROUP BY, so this projects
+// both attributes over a full table scan and is meant to run in the
+// background (see refreshCatalogFacets).
+func ScanCatalogFacets(ctx context.Context) (*CatalogFacets, error) {
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(productsTable),
+		ProjectionExpression:     aws.String("#category, brand"),
+		ExpressionAttributeNames: map[string]string{"#category": "category"},
+	}
+
+	categories := make(map[string]bool)
+	brands := make(map[string]int)
+	err := ParallelScan(ctx, input, scanSegments, func(items []map[string]types.AttributeValue) error {
+		var entries []struct {
+			Category string `dynamodbav:"category"`
+			Brand    string `dynamodbav:"brand"`
+		}
+		if err := attributevalue.UnmarshalListOfMaps(items, &entries); err != nil {
+			return fmt.Errorf("failed to unmarshal catalog facets: %v", err)
+		}
+		for _, entry := range entries {
+			if entry.Category != "" {
+				categories[entry.Category] = true
+			}
+			if entry.Brand != "" {
+				brands[entry.Brand]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan catalog facets: %v", err)
+	}
+
+	facets := &CatalogFacets{
+		Categories: slices.Sorted(maps.Keys(categories)),
+		Brands:     make([]BrandCount, 0, len(brands)),
+	}
+	for brand, count := range brands {
+		facets.Brands = append(facets.Brands, BrandCount{Brand: brand, Count: count})
+	}
+	sort.Slice(facets.Brands, func(i, j int) bool {
+		if facets.Brands[i].Count != facets.Brands[j].Count {
+			return facets.Brands[i].Count > facets.Brands[j].Count
+		}
+		return facets.Brands[i].Brand < facets.Brands[j].Brand
+	})
+	return facets, nil
+}
+
+// batchGetByIntKey fetches the items of table whose numeric hash key keyName
+// is in ids, using BatchGetItem in chunks of 100 keys (DynamoDB's limit) and
+// retrying unprocessed keys with backoff. Missing items are simply absent.
+func batchGetByIntKey(ctx context.Context, table, keyName string, ids []int) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+
+	// De-duplicate IDs, BatchGetItem rejects duplicate keys
+	seen := make(map[int]bool, len(ids))
+	keys := make([]map[string]types.AttributeValue, 0, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		keys = append(keys, map[string]types.AttributeValue{
+			keyName: &types.AttributeValueMemberN{Value: strconv.Itoa(id)},
+		})
+	}
+
+	for start := 0; start < len(keys); start += 100 {
+		end := start + 100
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		request := map[string]types.KeysAndAttributes{
+			table: {Keys: keys[start:end], ConsistentRead: aws.Bool(consistentReads)},
+		}
+
+		for attempt := 0; len(request) > 0; attempt++ {
+			if attempt > 0 {
+				if attempt > 5 {
+					return nil, fmt.Errorf("unprocessed keys remain in %s after retries", table)
+				}
+				select {
+				case <-time.After(time.Duration(attempt*50) * time.Millisecond):
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+			}
+
+			result, err := dynamoClient.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{
+				RequestItems: request,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, result.Responses[table]...)
+			request = result.UnprocessedKeys
+		}
+	}
+
+	return items, nil
+}
+
+// GetProducts retrieves many products at once using BatchGetItem.
+// Products that don't exist are simply absent from the map. If one can't be
+// decoded the error wraps ErrProductUndecodable, and the map returned with
+// it still holds every product that could be.
+func GetProducts(ctx context.Context, productIDs []int) (map[int]*ProductItem, error) {
+	items, err := batchGetByIntKey(ctx, productsTable, "product_id", productIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get products: %v", err)
+	}
+
+	products := make(map[int]*ProductItem, len(items))
+	var decodeErr error
+	for _, item := range items {
+		product, err := unmarshalProduct(item)
+		if err != nil {
+			decodeErr = fmt.Errorf("%w: %v", ErrProductUndecodable, err)
+			continue
+		}
+		products[product.ID] = product
+	}
+
+	return products, decodeErr
+}
+
+// GetProductsAllowStale is GetProducts for read-only endpoints, falling back
+// to stale in-memory products like GetProductAllowStale. Products are fetched
+// in chunks of one BatchGetItem call, and only the chunks that fail fall back.
+// Undecodable products don't fall back; they are reported like GetProducts
+// does.
+func GetProductsAllowStale(ctx context.Context, productIDs []int) (map[int]*ProductItem, error) {
+	products := make(map[int]*ProductItem, len(productIDs))
+	var decodeErr error
+	for start := 0; start < len(productIDs); start += 100 {
+		chunk := productIDs[start:min(start+100, len(productIDs))]
+		fetched, err := GetProducts(ctx, chunk)
+		switch {
+		case errors.Is(err, ErrProductUndecodable):
+			decodeErr = err
+		case err != nil:
+			log.Printf("Warning: DynamoDB unavailable, serving %d products from memory: %v", len(chunk), err)
+			fetched = cachedProducts(chunk)
+		}
+		maps.Copy(products, fetched)
+	}
+	return products, decodeErr
+}
+
+// cachedProducts looks products up in the in-memory catalog, marked as stale
+func cachedProducts(productIDs []int) map[int]*ProductItem {
+	products := make(map[int]*ProductItem, len(productIDs))
+	for _, id := range productIDs {
+		if product, ok := cachedProduct(id); ok {
+			products[id] = product
+		}
+	}
+	return products
+}
+
+// ToItem converts a DynamoDB product into the API Item representation
+func (p *ProductItem) ToItem() Item {
+	return Item{
+		ID:           p.ID,
+		SKU:          p.SKU,
+		Manufacturer: p.Manufacturer,
+		CategoryID:   p.CategoryID,
+		Weight:       p.Weight,
+		SomeOtherID:  p.SomeOtherID,
+		Name:         p.Name,
+		Category:     p.Category,
+		Description:  p.Description,
+		Brand:        p.Brand,
+		PriceCents:   p.PriceCents,
+		Stock:        p.Stock,
+		Reserved:     p.Reserved,
+		Version:      p.Version,
+		Stale:        p.Stale,
+	}
+}
+
+// ComputeCartTotal returns the cart subtotal in cents, pricing each line at
+// prices[productID] (cents). Lines without a price count as 0.
+func ComputeCartTotal(cart *CartItem, prices map[int]int) int {
+	total := 0
+	for _, item := range cart.Items {
+		total += item.Quantity * prices[item.ID]
+	}
+	return total
+}
+
+// GetCart retrieves a customer's cart
+func GetCart(ctx context.Context, customerID int) (*CartItem, error) {
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(cartsTable),
+		ConsistentRead: aws.Bool(consistentReads),
+		Key: map[string]types.AttributeValue{
+			"customer_id": &types.AttributeValueMemberN{Value: strconv.Itoa(customerID)},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cart: %v", err)
+	}
+
+	if result.Item == nil {
+		// Cart not found in DynamoDB - return error instead of empty cart
+		return nil, fmt.Errorf("%w for customer %d", ErrCartNotFound, customerID)
+	}
+
+	var cart CartItem
+	err = attributevalue.UnmarshalMap(result.Item, &cart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cart: %v", err)
+	}
+
+	// DynamoDB TTL deletion can lag by up to a few days, so treat expired carts as gone
+	if cart.ExpiresAt != 0 && time.Now().Unix() >= cart.ExpiresAt {
+		return nil, fmt.Errorf("%w for customer %d (expired)", ErrCartNotFound, customerID)
+	}
+
+	return &cart, nil
+}
+
+// GetCarts retrieves many carts at once. Carts that don't exist (or have
+// expired) are absent from the returned map.
+func GetCarts(ctx context.Context, customerIDs []int) (map[int]*CartItem, error) {
+	items, err := batchGetByIntKey(ctx, cartsTable, "customer_id", customerIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get carts: %v", err)
+	}
+
+	now := time.Now().Unix()
+	carts := make(map[int]*CartItem, len(items))
+	for _, item := range items {
+		var cart CartItem
+		if err := attributevalue.UnmarshalMap(item, &cart); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal cart: %v", err)
+		}
+		if cart.ExpiresAt != 0 && now >= cart.ExpiresAt {
+			continue
+		}
+		carts[cart.CustomerID] = &cart
+	}
+
+	return carts, nil
+}
+
+// ListCarts returns one page of carts from a Scan of the carts table. cursor
+// is the customer_id of the last cart on the previous page ("" for the first
+// page) and the returned cursor is "" once the scan is complete. Expired
+// carts are skipped, so a page may hold fewer than limit carts.
+func ListCarts(ctx context.Context, limit int, cursor string) ([]CartItem, string, error) {
+	input := &dynamodb.ScanInput{
+		TableName: aws.String(cartsTable),
+		Limit:     aws.Int32(int32(limit)),
+	}
+	if cursor != "" {
+		if _, err := strconv.Atoi(cursor); err != nil {
+			return nil, "", fmt.Errorf("invalid cursor %q", cursor)
+		}
+		input.ExclusiveStartKey = map[string]types.AttributeValue{
+			"customer_id": &types.AttributeValueMemberN{Value: cursor},
+		}
+	}
+
+	result, err := dynamoClient.Scan(ctx, input)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to scan carts: %v", err)
+	}
+
+	var scanned []CartItem
+	if err := attributevalue.UnmarshalListOfMaps(result.Items, &scanned); err != nil {
+		return nil, "", fmt.Errorf("failed to unmarshal carts: %v", err)
+	}
+
+	now := time.Now().Unix()
+	carts := make([]CartItem, 0, len(scanned))
+	for _, cart := range scanned {
+		if cart.ExpiresAt != 0 && now >= cart.ExpiresAt {
+			continue
+		}
+		carts = append(carts, cart)
+	}
+
+	nextCursor := ""
+	if key, ok := result.LastEvaluatedKey["customer_id"].(*types.AttributeValueMemberN); ok {
+		nextCursor = key.Value
+	}
+
+	return carts, nextCursor, nil
+}
+
+// FindCartsWithProduct returns the IDs of up to limit customers whose
+// (unexpired) cart contains productID, starting after the cursor customer ID,
+// plus the cursor of the next page ("" when the scan is complete).
+//
+// Cart items are a nested list of maps, which a `contains` filter can't match
+// on, so this scans the carts table and filters in memory. Every call reads
+// carts until it has limit matches, so it's meant for occasional admin use;
+// a reverse index (product_id -> customer_id) table maintained on cart writes
+// would be needed to make it cheap.
+func FindCartsWithProduct(ctx context.Context, productID, limit int, cursor string) ([]int, string, error) {
+	input := &dynamodb.ScanInput{
+		TableName:            aws.String(cartsTable),
+		ProjectionExpression: aws.String("customer_id, #items, expires_at"),
+		ExpressionAttributeNames: map[string]string{
+			"#items": "items",
+		},
+	}
+	if cursor != "" {
+		if _, err := strconv.Atoi(cursor); err != nil {
+			return nil, "", fmt.Errorf("invalid cursor %q", cursor)
+		}
+		input.ExclusiveStartKey = map[string]types.AttributeValue{
+			"customer_id": &types.AttributeValueMemberN{Value: cursor},
+		}
+	}
+
+	now := time.Now().Unix()
+	customerIDs := []int{}
+	for {
+		result, err := dynamoClient.Scan(ctx, input)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to scan carts: %v", err)
+		}
+
+		var carts []CartItem
+		if err := attributevalue.UnmarshalListOfMaps(result.Items, &carts); err != nil {
+			return nil, "", fmt.Errorf("failed to unmarshal carts: %v", err)
+		}
+
+		for i, cart := range carts {
+			if cart.ExpiresAt != 0 && now >= cart.ExpiresAt {
+				continue
+			}
+			for _, item := range cart.Items {
+				if item.ID == productID {
+					customerIDs = append(customerIDs, cart.CustomerID)
+					break
+				}
+			}
+			// Stop mid-page, the last examined customer is a valid start key
+			if len(customerIDs) == limit {
+				if i == len(carts)-1 && result.LastEvaluatedKey == nil {
+					return customerIDs, "", nil
+				}
+				return customerIDs, strconv.Itoa(cart.CustomerID), nil
+			}
+		}
+
+		if result.LastEvaluatedKey == nil {
+			return customerIDs, "", nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// CartAction tells what a cart write did to the product's line
+type CartAction string
+
+const (
+	CartActionAdded       CartAction = "added"       // the product was new to the cart
+	CartActionIncremented CartAction = "incremented" // an existing line's quantity was increased
+	CartActionSet         CartAction = "set"         // an existing line's quantity was replaced
+)
+
+// AddToCart adds a product to the customer's cart, incrementing the
+// quantity if the product is already in it, and returns the line's quantity
+// after the add. Each successful add also bumps the product's popularity
+// counter.
+func AddToCart(ctx context.Context, customerID, productID, quantity int) (CartAction, int, error) {
+	action, newQuantity, err := updateCartItem(ctx, customerID, productID, quantity, false)
+	if err != nil {
+		return "", 0, err
+	}
+
+	// The cart write already succeeded, a lost popularity increment is harmless
+	if err := IncrementPopularity(ctx, productID); err != nil {
+		log.Printf("Warning: failed to record popularity of product %d: %v", productID, err)
+	}
+	return action, newQuantity, nil
+}
+
+// SetCartItemQuantity sets the quantity of a product in the customer's cart,
+// replacing any existing quantity (or adding the line if it's missing)
+func SetCartItemQuantity(ctx context.Context, customerID, productID, quantity int) (CartAction, int, error) {
+	return updateCartItem(ctx, customerID, productID, quantity, true)
+}
+
+// updateCartItem adds quantity to a cart line, or replaces it when set is
+// true, returning the action taken and the line's new quantity
+func updateCartItem(ctx context.Context, customerID, productID, quantity int, set bool) (CartAction, int, error) {
+	changes := []cartChange{{productID: productID, quantity: quantity, set: set}}
+	if err := applyCartChanges(ctx, customerID, changes); err != nil {
+		return "", 0, err
+	}
+	return changes[0].action, changes[0].newQuantity, nil
+}
+
+// AddToCartBatch adds several products to the customer's cart with a single
+// read and write of the cart. quantities maps product ID to quantity added.
+func AddToCartBatch(ctx context.Context, customerID int, quantities map[int]int) error {
+	changes := make([]cartChange, 0, len(quantities))
+	for productID, quantity := range quantities {
+		changes = append(changes, cartChange{productID: productID, quantity: quantity})
+	}
+	if err := applyCartChanges(ctx, customerID, changes); err != nil {
+		return err
+	}
+
+	for productID := range quantities {
+		if err := IncrementPopularity(ctx, productID); err != nil {
+			log.Printf("Warning: failed to record popularity of product %d: %v", productID, err)
+		}
+	}
+	return nil
+}
+
+// cartChange is one line update applied by applyCartChanges
+type cartChange struct {
+	productID   int
+	quantity    int
+	set         bool       // replace the quantity instead of adding to it
+	action      CartAction // filled in by applyChangesToCart
+	newQuantity int        // line quantity after the change, filled in by applyChangesToCart
+}
+
+// linePrice is the price recorded on a cart line for product, nil if it
+// has none
+func linePrice(product *ProductItem) *int {
+	if product.Unpriced {
+		return nil
+	}
+	price := product.PriceCents
+	return &price
+}
+
+// applyChangesToCart applies changes to cart's lines in order, recording each
+// change's action and resulting quantity. products must hold every changed
+// product. It fails without finishing if a change would exceed
+// maxItemQuantity or add a line beyond maxCartItems.
+func applyChangesToCart(cart *CartItem, changes []cartChange, products map[int]*ProductItem) error {
+	for c := range changes {
+		change := &changes[c]
+
+		// Check if product already in cart
+		found := false
+		for i, item := range cart.Items {
+			if item.ID == change.productID {
+				current := cart.Items[i].Quantity
+				if change.set {
+					current = 0
+					change.action = CartActionSet
+				} else {
+					change.action = CartActionIncremented
+				}
+				quantity, err := addQuantity(current, change.quantity)
+				if err != nil {
+					return err
+				}
+				cart.Items[i].Quantity = quantity
+				cart.Items[i].PriceCents = linePrice(products[change.productID])
+				change.newQuantity = quantity
+
+				found = true
+				break
+			}
+		}
+
+		// Add new item if not found
+		if !found {
+			if len(cart.Items) >= maxCartItems {
+				return fmt.Errorf("%w (max %d)", ErrCartFull, maxCartItems)
+			}
+			if _, err := addQuantity(0, change.quantity); err != nil {
+				return err
+			}
+			product := products[change.productID]
+			cart.Items = append(cart.Items, CartProduct{
+				ID:           product.ID,
+				// SKU:          product.SKU,
+				Manufacturer: product.Manufacturer,
+				// CategoryID:   product.CategoryID,
+				// Weight:       product.Weight,
+				// SomeOtherID:  product.SomeOtherID,
+				// Name:         product.Name,
+				Category:     product.Category,
+				// Description:  product.Description,
+				// Brand:        product.Brand,
+				Quantity:     change.quantity,
+				PriceCents:   linePrice(product),
+			})
+			change.action = CartActionAdded
+			change.newQuantity = change.quantity
+		}
+	}
+	return nil
+}
+
+// applyCartChanges reads the cart once, applies every change in order and
+// writes it back once, recording each change's action and resulting
+// quantity. Any failing change
+// aborts the whole write.
+func applyCartChanges(ctx context.Context, customerID int, changes []cartChange) error {
+	// Get product details
+	products := make(map[int]*ProductItem, len(changes))
+	for _, change := range changes {
+		product, err := GetProduct(ctx, change.productID)
+		if err != nil {
+			return fmt.Errorf("product not found: %v", err)
+		}
+		products[change.productID] = product
+	}
+
+	// Serialize with other writes of this cart on this instance
+	unlock, err := lockCustomers(ctx, customerID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Get existing cart
+	cart, err := GetCart(ctx, customerID)
+	if err != nil {
+		return fmt.Errorf("failed to get cart: %v", err)
+	}
+	previousVersion := cart.Version
+
+	if err := applyChangesToCart(cart, changes, products); err != nil {
+		return err
+	}
+
+	cart.UpdatedAt = nowRFC3339()
+	cart.Version++
+	cart.ExpiresAt = cartExpiry()
+
+	// Reserve stock for the changed lines (see reservations.go)
+	var reserved, toRelease []stockAdjustment
+	if reservationTTL > 0 {
+		productIDs := make([]int, 0, len(changes))
+		for _, change := range changes {
+			productIDs = append(productIDs, change.productID)
+		}
+		reserved, toRelease, err = reserveCartLines(ctx, cart, productIDs)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Marshal cart to DynamoDB format
+	item, err := attributevalue.MarshalMap(cart)
+	if err != nil {
+		releaseAll(ctx, reserved)
+		return fmt.Errorf("failed to marshal cart: %v", err)
+	}
+
+	// Fail with a clear error instead of a cryptic PutItem validation failure
+	if size := estimateItemSize(item); size > maxItemSizeBytes {
+		releaseAll(ctx, reserved)
+		return fmt.Errorf("%w (%d bytes, limit %d)", ErrCartTooLarge, size, maxItemSizeBytes)
+	}
+
+	// Put cart back to DynamoDB, conditioned on its version so a write by
+	// another instance (or a reservation sweep) since the read isn't lost
+	condition, names, values := cartVersionCondition(previousVersion)
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(cartsTable),
+		Item:                      item,
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		releaseAll(ctx, reserved)
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return fmt.Errorf("%w: %v", ErrCartConflict, err)
+		}
+		return fmt.Errorf("failed to update cart: %v", err)
+	}
+
+	// Lowered quantities give their surplus back only once the cart is written
+	releaseAll(ctx, toRelease)
+
+	for _, change := range changes {
+		eventType := CartEventItemUpdated
+		if change.action == CartActionAdded {
+			eventType = CartEventItemAdded
+		}
+		emitCartEvent(customerID, eventType, change.productID)
+	}
+	return nil
+}
+
+// CreateCart stores a new empty cart for the customer, replacing any expired
+// one still stored. It fails with ErrCartExists if the customer has a live
+// cart, even one a stale read missed.
+func CreateCart(ctx context.Context, customerID int) (*CartItem, error) {
+	now := nowRFC3339()
+	cart := &CartItem{
+		CustomerID: customerID,
+		Items:      []CartProduct{},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		ExpiresAt:  cartExpiry(),
+	}
+
+	item, err := attributevalue.MarshalMap(cart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cart: %v", err)
+	}
+	// An expired cart may still be stored until DynamoDB's TTL removes it
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(cartsTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(customer_id) OR expires_at <= :now"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		},
+	})
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return nil, fmt.Errorf("%w: customer %d", ErrCartExists, customerID)
+		}
+		return nil, fmt.Errorf("failed to save cart: %v", err)
+	}
+	return cart, nil
+}
+
+// addQuantity returns current+added, or ErrQuantityTooLarge if that would
+// exceed maxItemQuantity. The check is done by subtraction so a huge added
+// can't overflow int and wrap to a negative quantity first.
+func addQuantity(current, added int) (int, error) {
+	if added > maxItemQuantity-current {
+		return 0, fmt.Errorf("%w (max %d)", ErrQuantityTooLarge, maxItemQuantity)
+	}
+	return current + added, nil
+}
+
+// nowRFC3339 is the current time in UTC as stored in created_at/updated_at,
+// so timestamps don't depend on the time zone of the instance writing them
+func nowRFC3339() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// cartExpiry returns the TTL timestamp for a cart written now
+func cartExpiry() int64 {
+	return time.Now().Add(cartTTL).Unix()
+}
+
+// MoveCartItem transfers a line item (with its full quantity) from one
+// customer's cart to another's. Both carts are written in a single
+// TransactWriteItems call, each conditioned on its version being unchanged
+// since it was read, so the item can never be duplicated or lost.
+func MoveCartItem(ctx context.Context, fromCustomerID, toCustomerID, productID int) (*CartItem, *CartItem, error) {
+	unlock, err := lockCustomers(ctx, fromCustomerID, toCustomerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	source, err := GetCart(ctx, fromCustomerID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get source cart: %w", err)
+	}
+	target, err := GetCart(ctx, toCustomerID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get target cart: %w", err)
+	}
+	sourceVersion, targetVersion := source.Version, target.Version
+
+	// Remove the item from the source cart
+	index := -1
+	for i, item := range source.Items {
+		if item.ID == productID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, nil, fmt.Errorf("%w: product %d, customer %d", ErrItemNotInCart, productID, fromCustomerID)
+	}
+	moved := source.Items[index]
+	source.Items = append(source.Items[:index], source.Items[index+1:]...)
+
+	// Merge it into the target cart, the reservation moves with it
+	found := false
+	for i, item := range target.Items {
+		if item.ID == productID {
+			quantity, err := addQuantity(item.Quantity, moved.Quantity)
+			if err != nil {
+				return nil, nil, err
+			}
+			target.Items[i].Quantity = quantity
+			target.Items[i].Reserved += moved.Reserved
+			target.Items[i].ReservedUntil = max(item.ReservedUntil, moved.ReservedUntil)
+			found = true
+			break
+		}
+	}
+	if !found {
+		if len(target.Items) >= maxCartItems {
+			return nil, nil, fmt.Errorf("%w (max %d)", ErrCartFull, maxCartItems)
+		}
+		target.Items = append(target.Items, moved)
+	}
+
+	now := nowRFC3339()
+	source.UpdatedAt = now
+	source.Version++
+	target.UpdatedAt = now
+	target.Version++
+	source.ExpiresAt = cartExpiry()
+	target.ExpiresAt = cartExpiry()
+
+	sourceItem, err := attributevalue.MarshalMap(source)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal source cart: %v", err)
+	}
+	targetItem, err := attributevalue.MarshalMap(target)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal target cart: %v", err)
+	}
+	if size := estimateItemSize(targetItem); size > maxItemSizeBytes {
+		return nil, nil, fmt.Errorf("%w (%d bytes, limit %d)", ErrCartTooLarge, size, maxItemSizeBytes)
+	}
+
+	_, err = dynamoClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: cartPutIfUnchanged(cartsTable, sourceItem, sourceVersion)},
+			{Put: cartPutIfUnchanged(cartsTable, targetItem, targetVersion)},
+		},
+	})
+	if err != nil {
+		var cancelled *types.TransactionCanceledException
+		if errors.As(err, &cancelled) {
+			return nil, nil, fmt.Errorf("%w: %v", ErrCartConflict, err)
+		}
+		return nil, nil, fmt.Errorf("failed to move cart item: %v", err)
+	}
+
+	emitCartEvent(fromCustomerID, CartEventItemRemoved, productID)
+	emitCartEvent(toCustomerID, mergedEventType(found), productID)
+	return source, target, nil
+}
+
+// TransferCart moves a customer's cart to another customer ID, e.g. after
+// accounts are merged. If the target has no cart the source cart is re-keyed
+// as is; if it has one, the transfer fails with ErrCartExists unless merge is
+// set, in which case the source lines are merged into it like MoveCartItem
+// does (the target keeps its name, notes and promo, taking the source promo
+// only if it has none). The target write and the source delete are a single
+// TransactWriteItems call, conditioned like MoveCartItem, so the cart can
+// never end up under both IDs or neither.
+func TransferCart(ctx context.Context, fromCustomerID, toCustomerID int, merge bool) (*CartItem, error) {
+	unlock, err := lockCustomers(ctx, fromCustomerID, toCustomerID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	source, err := GetCart(ctx, fromCustomerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get source cart: %w", err)
+	}
+	target, err := GetCart(ctx, toCustomerID)
+	if err != nil && !errors.Is(err, ErrCartNotFound) {
+		return nil, fmt.Errorf("failed to get target cart: %w", err)
+	}
+	if target != nil && !merge {
+		return nil, fmt.Errorf("%w: customer %d", ErrCartExists, toCustomerID)
+	}
+
+	now := nowRFC3339()
+	var targetPut *types.Put
+	var events []CartEvent
+	if target == nil {
+		moved := *source
+		moved.CustomerID = toCustomerID
+		moved.UpdatedAt = now
+		moved.Version++
+		moved.ExpiresAt = cartExpiry()
+		target = &moved
+
+		targetItem, err := attributevalue.MarshalMap(target)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal target cart: %v", err)
+		}
+		// An expired cart may still be stored until DynamoDB's TTL removes it
+		targetPut = &types.Put{
+			TableName:           aws.String(cartsTable),
+			Item:                targetItem,
+			ConditionExpression: aws.String("attribute_not_exists(customer_id) OR expires_at <= :now"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+			},
+		}
+		for _, item := range target.Items {
+			events = append(events, CartEvent{Type: CartEventItemAdded, ProductID: item.ID})
+		}
+	} else {
+		targetVersion := target.Version
+		for _, moved := range source.Items {
+			found := false
+			for i, item := range target.Items {
+				if item.ID == moved.ID {
+					quantity, err := addQuantity(item.Quantity, moved.Quantity)
+					if err != nil {
+						return nil, err
+					}
+					target.Items[i].Quantity = quantity
+					target.Items[i].Reserved += moved.Reserved
+					target.Items[i].ReservedUntil = max(item.ReservedUntil, moved.ReservedUntil)
+					found = true
+					break
+				}
+			}
+			if !found {
+				if len(target.Items) >= maxCartItems {
+					return nil, fmt.Errorf("%w (max %d)", ErrCartFull, maxCartItems)
+				}
+				target.Items = append(target.Items, moved)
+			}
+			events = append(events, CartEvent{Type: mergedEventType(found), ProductID: moved.ID})
+		}
+		if target.PromoCode == "" {
+			target.PromoCode = source.PromoCode
+		}
+		target.UpdatedAt = now
+		target.Version++
+		target.ExpiresAt = cartExpiry()
+
+		targetItem, err := attributevalue.MarshalMap(target)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal target cart: %v", err)
+		}
+		targetPut = cartPutIfUnchanged(cartsTable, targetItem, targetVersion)
+	}
+	if size := estimateItemSize(targetPut.Item); size > maxItemSizeBytes {
+		return nil, fmt.Errorf("%w (%d bytes, limit %d)", ErrCartTooLarge, size, maxItemSizeBytes)
+	}
+
+	condition, names, values := cartVersionCondition(source.Version)
+	_, err = dynamoClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: targetPut},
+			{Delete: &types.Delete{
+				TableName: aws.String(cartsTable),
+				Key: map[string]types.AttributeValue{
+					"customer_id": &types.AttributeValueMemberN{Value: strconv.Itoa(fromCustomerID)},
+				},
+				ConditionExpression:       aws.String(condition),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+			}},
+		},
+	})
+	if err != nil {
+		var cancelled *types.TransactionCanceledException
+		if errors.As(err, &cancelled) {
+			return nil, fmt.Errorf("%w: %v", ErrCartConflict, err)
+		}
+		return nil, fmt.Errorf("failed to transfer cart: %v", err)
+	}
+
+	emitCartEvent(fromCustomerID, CartEventCartDeleted, 0)
+	for _, event := range events {
+		emitCartEvent(toCustomerID, event.Type, event.ProductID)
+	}
+	return target, nil
+}
+
+// cartPutIfUnchanged builds a transactional cart (or wishlist) Put that only
+// succeeds if the stored item still has the version it was read with.
+// updated_at has only second precision, so it can't tell two writes in the
+// same second apart.
+func cartPutIfUnchanged(table string, item map[string]types.AttributeValue, version int) *types.Put {
+	condition, names, values := cartVersionCondition(version)
+	return &types.Put{
+		TableName:                 aws.String(table),
+		Item:                      item,
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}
+}
+
+// cartVersionCondition builds the condition for writing back a cart (or
+// wishlist) read at version, failing if anything wrote it since. Carts
+// stored before versions were introduced have no version attribute and
+// read as version 0.
+func cartVersionCondition(version int) (string, map[string]string, map[string]types.AttributeValue) {
+	condition := "#version = :version"
+	if version == 0 {
+		condition = "attribute_not_exists(#version) OR " + condition
+	}
+	return condition,
+		map[string]string{"#version": "version"},
+		map[string]types.AttributeValue{
+			":version": &types.AttributeValueMemberN{Value: strconv.Itoa(version)},
+		}
+}
+
+// ErasureSummary reports what DeleteCustomerData removed
+type ErasureSummary struct {
+	CustomerID           int  `json:"customer_id"`
+	CartDeleted          bool `json:"cart_deleted"`
+	WishlistDeleted      bool `json:"wishlist_deleted"`
+	ReservationsReleased int  `json:"reservations_released"`
+}
+
+// DeleteCustomerData erases a customer's cart and wishlist, returning any
+// stock their cart had reserved. Everything is done in one TransactWriteItems
+// call when it fits the 100 item limit; otherwise reservations are released
+// one by one before the deletes, stopping at the first failure so a retry
+// picks up where it left off. Reservations of deleted products are skipped,
+// and the erasure fails with ErrCartConflict if the cart changed since it
+// was read.
+func DeleteCustomerData(ctx context.Context, customerID int) (*ErasureSummary, error) {
+	summary := &ErasureSummary{CustomerID: customerID}
+	key := map[string]types.AttributeValue{
+		"customer_id": &types.AttributeValueMemberN{Value: strconv.Itoa(customerID)},
+	}
+
+	unlock, err := lockCustomers(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	cart, err := GetCart(ctx, customerID)
+	if err != nil && !errors.Is(err, ErrCartNotFound) {
+		return nil, err
+	}
+	var releases []stockAdjustment
+	if cart != nil {
+		summary.CartDeleted = true
+		for _, line := range cart.Items {
+			if line.Reserved > 0 {
+				releases = append(releases, stockAdjustment{productID: line.ID, quantity: line.Reserved})
+			}
+		}
+		// A deleted product's release would fail its condition and cancel the
+		// whole transaction, and its stock is gone anyway
+		releases, err = dropDeletedProducts(ctx, releases)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if wishlistsTable != "" {
+		_, err := GetWishlist(ctx, customerID)
+		if err != nil && !errors.Is(err, ErrWishlistNotFound) {
+			return nil, err
+		}
+		summary.WishlistDeleted = err == nil
+	}
+
+	// A cart that was read is deleted only at that version, so a
+	// reservation made since isn't lost. Expired carts read as not found but
+	// may still be stored, so their delete is unconditional.
+	cartDelete := &types.Delete{TableName: aws.String(cartsTable), Key: key}
+	if cart != nil {
+		condition, names, values := cartVersionCondition(cart.Version)
+		cartDelete.ConditionExpression = aws.String(condition)
+		cartDelete.ExpressionAttributeNames = names
+		cartDelete.ExpressionAttributeValues = values
+	}
+	deletes := []types.TransactWriteItem{{Delete: cartDelete}}
+	if wishlistsTable != "" {
+		deletes = append(deletes, types.TransactWriteItem{
+			Delete: &types.Delete{TableName: aws.String(wishlistsTable), Key: key},
+		})
+	}
+
+	if len(releases)+len(deletes) <= 100 {
+		transactItems := deletes
+		for _, release := range releases {
+			transactItems = append(transactItems, types.TransactWriteItem{
+				Update: releaseStockUpdate(release.productID, release.quantity),
+			})
+		}
+		_, err := dynamoClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: transactItems,
+		})
+		if err != nil {
+			var cancelled *types.TransactionCanceledException
+			if errors.As(err, &cancelled) {
+				return nil, fmt.Errorf("%w: %v", ErrCartConflict, err)
+			}
+			return nil, fmt.Errorf("failed to delete customer data: %v", err)
+		}
+		summary.ReservationsReleased = len(releases)
+		if summary.CartDeleted {
+			emitCartEvent(customerID, CartEventCartDeleted, 0)
+		}
+		return summary, nil
+	}
+
+	for _, release := range releases {
+		if err := ReleaseStock(ctx, release.productID, release.quantity); err != nil {
+			return nil, fmt.Errorf("released %d of %d reservations: %w", summary.ReservationsReleased, len(releases), err)
+		}
+		summary.ReservationsReleased++
+	}
+	for _, item := range deletes {
+		_, err := dynamoClient.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName:                 item.Delete.TableName,
+			Key:                       item.Delete.Key,
+			ConditionExpression:       item.Delete.ConditionExpression,
+			ExpressionAttributeNames:  item.Delete.ExpressionAttributeNames,
+			ExpressionAttributeValues: item.Delete.ExpressionAttributeValues,
+		})
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return nil, fmt.Errorf("%w: %v", ErrCartConflict, err)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete from %s: %v", *item.Delete.TableName, err)
+		}
+	}
+	if summary.CartDeleted {
+		emitCartEvent(customerID, CartEventCartDeleted, 0)
+	}
+	return summary, nil
+}
+
+// dropDeletedProducts returns the releases whose product still exists
+func dropDeletedProducts(ctx context.Context, releases []stockAdjustment) ([]stockAdjustment, error) {
+	if len(releases) == 0 {
+		return releases, nil
+	}
+	productIDs := make([]int, len(releases))
+	for i, release := range releases {
+		productIDs[i] = release.productID
+	}
+	items, err := batchGetByIntKey(ctx, productsTable, "product_id", productIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up reserved products: %v", err)
+	}
+	exists := make(map[string]bool, len(items))
+	for _, item := range items {
+		if id, ok := item["product_id"].(*types.AttributeValueMemberN); ok {
+			exists[id.Value] = true
+		}
+	}
+
+	kept := releases[:0]
+	for _, release := range releases {
+		if exists[strconv.Itoa(release.productID)] {
+			kept = append(kept, release)
+		} else {
+			log.Printf("Warning: not releasing %d of deleted product %d", release.quantity, release.productID)
+		}
+	}
+	return kept, nil
+}
+
+// GetWishlist retrieves a customer's wishlist. Wishlists share the CartItem
+// shape and are keyed by customer_id, exactly like carts.
+func GetWishlist(ctx context.Context, customerID int) (*CartItem, error) {
+	if wishlistsTable == "" {
+		return nil, ErrWishlistsDisabled
+	}
+
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(wishlistsTable),
+		ConsistentRead: aws.Bool(consistentReads),
+		Key: map[string]types.AttributeValue{
+			"customer_id": &types.AttributeValueMemberN{Value: strconv.Itoa(customerID)},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wishlist: %v", err)
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("%w for customer %d", ErrWishlistNotFound, customerID)
+	}
+
+	var wishlist CartItem
+	err = attributevalue.UnmarshalMap(result.Item, &wishlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal wishlist: %v", err)
+	}
+
+	return &wishlist, nil
+}
+
+// AddToWishlist adds a product to the customer's wishlist, creating the
+// wishlist on first use. Like cart writes it is conditioned on the wishlist's
+// version, see putWishlistIfUnchanged.
+func AddToWishlist(ctx context.Context, customerID, productID, quantity int) (*CartItem, error) {
+	// Get product details
+	product, err := GetProduct(ctx, productID)
+	if err != nil {
+		return nil, fmt.Errorf("product not found: %v", err)
+	}
+
+	// Serialize with other writes of this customer on this instance
+	unlock, err := lockCustomers(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// Get existing wishlist, or start a new one
+	wishlist, err := GetWishlist(ctx, customerID)
+	if errors.Is(err, ErrWishlistNotFound) {
+		now := nowRFC3339()
+		wishlist = &CartItem{
+			CustomerID: customerID,
+			Items:      []CartProduct{},
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	previousVersion := wishlist.Version
+
+	// Check if product already in wishlist
+	found := false
+	for i, item := range wishlist.Items {
+		if item.ID == productID {
+			total, err := addQuantity(item.Quantity, quantity)
+			if err != nil {
+				return nil, err
+			}
+			wishlist.Items[i].Quantity = total
+			found = true
+			break
+		}
+	}
+
+	// Add new item if not found
+	if !found {
+		if len(wishlist.Items) >= maxCartItems {
+			return nil, fmt.Errorf("%w (max %d)", ErrCartFull, maxCartItems)
+		}
+		if _, err := addQuantity(0, quantity); err != nil {
+			return nil, err
+		}
+		wishlist.Items = append(wishlist.Items, CartProduct{
+			ID:           product.ID,
+			Manufacturer: product.Manufacturer,
+			Category:     product.Category,
+			Quantity:     quantity,
+		})
+	}
+
+	wishlist.UpdatedAt = nowRFC3339()
+	wishlist.Version++
+
+	if err := putWishlistIfUnchanged(ctx, wishlist, previousVersion); err != nil {
+		return nil, err
+	}
+
+	return wishlist, nil
+}
+
+// RemoveFromWishlist removes a product from the customer's wishlist,
+// conditioned on its version like AddToWishlist
+func RemoveFromWishlist(ctx context.Context, customerID, productID int) (*CartItem, error) {
+	// Serialize with other writes of this customer on this instance
+	unlock, err := lockCustomers(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	wishlist, err := GetWishlist(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	previousVersion := wishlist.Version
+
+	index := -1
+	for i, item := range wishlist.Items {
+		if item.ID == productID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("%w: product %d, customer %d", ErrItemNotInCart, productID, customerID)
+	}
+	wishlist.Items = append(wishlist.Items[:index], wishlist.Items[index+1:]...)
+	wishlist.UpdatedAt = nowRFC3339()
+	wishlist.Version++
+
+	if err := putWishlistIfUnchanged(ctx, wishlist, previousVersion); err != nil {
+		return nil, err
+	}
+
+	return wishlist, nil
+}
+
+// putWishlistIfUnchanged writes back a wishlist read at previousVersion,
+// failing with ErrCartConflict if anything wrote it since
+func putWishlistIfUnchanged(ctx context.Context, wishlist *CartItem, previousVersion int) error {
+	item, err := attributevalue.MarshalMap(wishlist)
+	if err != nil {
+		return fmt.Errorf("failed to marshal wishlist: %v", err)
+	}
+
+	put := cartPutIfUnchanged(wishlistsTable, item, previousVersion)
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 put.TableName,
+		Item:                      put.Item,
+		ConditionExpression:       put.ConditionExpression,
+		ExpressionAttributeNames:  put.ExpressionAttributeNames,
+		ExpressionAttributeValues: put.ExpressionAttributeValues,
+	})
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return fmt.Errorf("%w: %v", ErrCartConflict, err)
+		}
+		return fmt.Errorf("failed to update wishlist: %v", err)
+	}
+	return nil
+}
+
+// MoveWishlistItemToCart transfers a product (with its quantity) from the
+// customer's wishlist to their cart in a single transaction, using the same
+// version conditions as MoveCartItem
+func MoveWishlistItemToCart(ctx context.Context, customerID, productID int) (*CartItem, *CartItem, error) {
+	unlock, err := lockCustomers(ctx, customerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	wishlist, err := GetWishlist(ctx, customerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	cart, err := GetCart(ctx, customerID)
+	if err != nil {
+		return nil, nil, err
+	}
+	wishlistVersion, cartVersion := wishlist.Version, cart.Version
+
+	index := -1
+	for i, item := range wishlist.Items {
+		if item.ID == productID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, nil, fmt.Errorf("%w: product %d, customer %d", ErrItemNotInCart, productID, customerID)
+	}
+	moved := wishlist.Items[index]
+	wishlist.Items = append(wishlist.Items[:index], wishlist.Items[index+1:]...)
+
+	found := false
+	for i, item := range cart.Items {
+		if item.ID == productID {
+			quantity, err := addQuantity(item.Quantity, moved.Quantity)
+			if err != nil {
+				return nil, nil, err
+			}
+			cart.Items[i].Quantity = quantity
+			found = true
+			break
+		}
+	}
+	if !found {
+		if len(cart.Items) >= maxCartItems {
+			return nil, nil, fmt.Errorf("%w (max %d)", ErrCartFull, maxCartItems)
+		}
+		cart.Items = append(cart.Items, moved)
+	}
+
+	now := nowRFC3339()
+	wishlist.UpdatedAt = now
+	wishlist.Version++
+	cart.UpdatedAt = now
+	cart.Version++
+	cart.ExpiresAt = cartExpiry()
+
+	wishlistItem, err := attributevalue.MarshalMap(wishlist)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal wishlist: %v", err)
+	}
+	cartItem, err := attributevalue.MarshalMap(cart)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal cart: %v", err)
+	}
+	if size := estimateItemSize(cartItem); size > maxItemSizeBytes {
+		return nil, nil, fmt.Errorf("%w (%d bytes, limit %d)", ErrCartTooLarge, size, maxItemSizeBytes)
+	}
+
+	_, err = dynamoClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: cartPutIfUnchanged(wishlistsTable, wishlistItem, wishlistVersion)},
+			{Put: cartPutIfUnchanged(cartsTable, cartItem, cartVersion)},
+		},
+	})
+	if err != nil {
+		var cancelled *types.TransactionCanceledException
+		if errors.As(err, &cancelled) {
+			return nil, nil, fmt.Errorf("%w: %v", ErrCartConflict, err)
+		}
+		return nil, nil, fmt.Errorf("failed to move wishlist item: %v", err)
+	}
+
+	emitCartEvent(customerID, mergedEventType(found), productID)
+	return wishlist, cart, nil
+}
+
+// mergedEventType is the event of a line merged into a cart, found telling
+// whether the cart already had the product
+func mergedEventType(found bool) CartEventType {
+	if found {
+		return CartEventItemUpdated
+	}
+	return CartEventItemAdded
+}
+
+// Promo discount types
+const (
+	PromoTypePercent = "percent" // Value is a percentage of the subtotal (1-100)
+	PromoTypeFixed   = "fixed"   // Value is an amount in cents
+)
+
+// Promo is a discount code stored in the promos table
+type Promo struct {
+	Code      string `dynamodbav:"code" json:"code"`
+	Type      string `dynamodbav:"type" json:"type"`
+	Value     int    `dynamodbav:"value" json:"value"`
+	ExpiresAt int64  `dynamodbav:"expires_at" json:"expires_at,omitempty"` // epoch seconds, 0 never expires
+}
+
+// Expired reports whether the promo is past its expiry at now
+func (p *Promo) Expired(now time.Time) bool {
+	return p.ExpiresAt > 0 && now.Unix() >= p.ExpiresAt
+}
+
+// Discount returns the discount in cents on subtotal, never more than the
+// subtotal itself. Percentages are rounded half up to the cent.
+func (p *Promo) Discount(subtotal int) int {
+	switch p.Type {
+	case PromoTypePercent:
+		return min(int(math.Round(float64(subtotal)*float64(p.Value)/100)), subtotal)
+	case PromoTypeFixed:
+		return min(p.Value, subtotal)
+	}
+	return 0
+}
+
+// GetPromo looks up a promo code. It does not check expiry.
+func GetPromo(ctx context.Context, code string) (*Promo, error) {
+	if promosTable == "" {
+		return nil, ErrPromosDisabled
+	}
+
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(promosTable),
+		ConsistentRead: aws.Bool(consistentReads),
+		Key: map[string]types.AttributeValue{
+			"code": &types.AttributeValueMemberS{Value: code},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get promo: %v", err)
+	}
+
+	if result.Item == nil {
+		return nil, fmt.Errorf("%w: %q", ErrPromoNotFound, code)
+	}
+
+	var promo Promo
+	if err := attributevalue.UnmarshalMap(result.Item, &promo); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal promo: %v", err)
+	}
+	return &promo, nil
+}
+
+// SetCartPromo stores code as the cart's applied promo, or clears it when
+// code is empty. Like other cart writes it refreshes updated_at and the TTL,
+// and it is conditioned on the cart being unchanged since it was read.
+func SetCartPromo(ctx context.Context, customerID int, code string) (*CartItem, error) {
+	unlock, err := lockCustomers(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	cart, err := GetCart(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	previousVersion := cart.Version
+
+	cart.PromoCode = code
+	cart.UpdatedAt = nowRFC3339()
+	cart.Version++
+	cart.ExpiresAt = cartExpiry()
+
+	item, err := attributevalue.MarshalMap(cart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cart: %v", err)
+	}
+
+	put := cartPutIfUnchanged(cartsTable, item, previousVersion)
+	_, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 put.TableName,
+		Item:                      put.Item,
+		ConditionExpression:       put.ConditionExpression,
+		ExpressionAttributeNames:  put.ExpressionAttributeNames,
+		ExpressionAttributeValues: put.ExpressionAttributeValues,
+	})
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return nil, fmt.Errorf("%w: %v", ErrCartConflict, err)
+		}
+		return nil, fmt.Errorf("failed to update cart: %v", err)
+	}
+
+	return cart, nil
+}
+
+// CartMetadata holds a partial update of a cart's labels. Nil fields are
+// left untouched, an empty string clears the field.
+type CartMetadata struct {
+	Name  *string `json:"name"`
+	Notes *string `json:"notes"`
+}
+
+// UpdateCartMetadata sets the cart's name and notes with a targeted
+// UpdateItem, leaving its items as they are, and returns the updated cart.
+// The cart's version is bumped too, so a concurrent full-cart write that read
+// the old labels fails its version condition instead of putting them back.
+func UpdateCartMetadata(ctx context.Context, customerID int, metadata CartMetadata) (*CartItem, error) {
+	names := map[string]string{"#version": "version"}
+	values := map[string]types.AttributeValue{
+		":one":        &types.AttributeValueMemberN{Value: "1"},
+		":updated_at": &types.AttributeValueMemberS{Value: nowRFC3339()},
+		":expires_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(cartExpiry(), 10)},
+		":now":        &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Unix(), 10)},
+	}
+	assignments := []string{"updated_at = :updated_at", "expires_at = :expires_at"}
+	// Placeholders for names, since "name" is a DynamoDB reserved word
+	if metadata.Name != nil {
+		names["#name"] = "name"
+		values[":name"] = &types.AttributeValueMemberS{Value: *metadata.Name}
+		assignments = append(assignments, "#name = :name")
+	}
+	if metadata.Notes != nil {
+		names["#notes"] = "notes"
+		values[":notes"] = &types.AttributeValueMemberS{Value: *metadata.Notes}
+		assignments = append(assignments, "#notes = :notes")
+	}
+
+	result, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(cartsTable),
+		Key: map[string]types.AttributeValue{
+			"customer_id": &types.AttributeValueMemberN{Value: strconv.Itoa(customerID)},
+		},
+		UpdateExpression: aws.String("SET " + strings.Join(assignments, ", ") + " ADD #version :one"),
+		// Expired carts read as not found, so they can't be relabelled either
+		ConditionExpression:       aws.String("attribute_exists(customer_id) AND (attribute_not_exists(expires_at) OR expires_at > :now)"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			return nil, ErrCartNotFound
+		}
+		return nil, fmt.Errorf("failed to update cart: %v", err)
+	}
+
+	var cart CartItem
+	if err := attributevalue.UnmarshalMap(result.Attributes, &cart); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal cart: %v", err)
+	}
+	return &cart, nil
+}
+
+// estimateItemSize approximates the stored size of a DynamoDB item using
+// DynamoDB's sizing rules: attribute names count as UTF-8 bytes, numbers take
+// roughly one byte per two significant digits, and lists/maps add 3 bytes of
+// overhead plus 1 byte per element.
+func estimateItemSize(item map[string]types.AttributeValue) int {
+	size := 0
+	for name, value := range item {
+		size += len(name) + attributeValueSize(value)
+	}
+	return size
+}
+
+func attributeValueSize(value types.AttributeValue) int {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return len(v.Value)
+	case *types.AttributeValueMemberN:
+		return (len(v.Value)+1)/2 + 1
+	case *types.AttributeValueMemberB:
+		return len(v.Value)
+	case *types.AttributeValueMemberBOOL, *types.AttributeValueMemberNULL:
+		return 1
+	case *types.AttributeValueMemberL:
+		size := 3
+		for _, element := range v.Value {
+			size += 1 + attributeValueSize(element)
+		}
+		return size
+	case *types.AttributeValueMemberM:
+		size := 3
+		for name, element := range v.Value {
+			size += 1 + len(name) + attributeValueSize(element)
+		}
+		return size
+	case *types.AttributeValueMemberSS:
+		size := 0
+		for _, element := range v.Value {
+			size += len(element)
+		}
+		return size
+	case *types.AttributeValueMemberNS:
+		size := 0
+		for _, element := range v.Value {
+			size += (len(element)+1)/2 + 1
+		}
+		return size
+	case *types.AttributeValueMemberBS:
+		size := 0
+		for _, element := range v.Value {
+			size += len(element)
+		}
+		return size
+	}
+	return 0
+}
+
+// rawTables maps the names accepted by GetRawItem to their table and hash key
+var rawTables = map[string]struct {
+	table   *string
+	keyName string
+	numeric bool
+}{
+	"products":  {&productsTable, "product_id", true},
+	"carts":     {&cartsTable, "customer_id", true},
+	"wishlists": {&wishlistsTable, "customer_id", true},
+	"promos":    {&promosTable, "code", false},
+}
+
+// ErrUnknownTable is returned by GetRawItem for a table name not in rawTables
+var ErrUnknownTable = errors.New("unknown table")
+
+// ErrInvalidKey is returned by GetRawItem for a non-numeric key of a numeric-keyed table
+var ErrInvalidKey = errors.New("invalid key")
+
+// ErrItemNotFound is returned by GetRawItem when no item has the key
+var ErrItemNotFound = errors.New("item not found")
+
+// GetRawItem fetches an item exactly as stored, without unmarshaling, in
+// DynamoDB JSON (e.g. {"stock": {"N": "12"}}). name is one of rawTables.
+func GetRawItem(ctx context.Context, name, key string) (map[string]any, error) {
+	target, ok := rawTables[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownTable, name)
+	}
+	if *target.table == "" {
+		return nil, fmt.Errorf("%w %q: not configured", ErrUnknownTable, name)
+	}
+
+	var keyValue types.AttributeValue = &types.AttributeValueMemberS{Value: key}
+	if target.numeric {
+		if _, err := strconv.Atoi(key); err != nil {
+			return nil, fmt.Errorf("%w: key of %s must be numeric", ErrInvalidKey, name)
+		}
+		keyValue = &types.AttributeValueMemberN{Value: key}
+	}
+
+	result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      target.table,
+		Key:            map[string]types.AttributeValue{target.keyName: keyValue},
+		ConsistentRead: aws.Bool(true), // show what is stored right now
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get raw item: %v", err)
+	}
+	if result.Item == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrItemNotFound, name, key)
+	}
+
+	raw := make(map[string]any, len(result.Item))
+	for attr, value := range result.Item {
+		raw[attr] = rawAttributeValue(value)
+	}
+	return raw, nil
+}
+
+// rawAttributeValue converts an attribute value to DynamoDB JSON, keeping its
+// type descriptor. Binary values become base64 through encoding/json.
+func rawAttributeValue(value types.AttributeValue) any {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return map[string]any{"S": v.Value}
+	case *types.AttributeValueMemberN:
+		return map[string]any{"N": v.Value}
+	case *types.AttributeValueMemberB:
+		return map[string]any{"B": v.Value}
+	case *types.AttributeValueMemberBOOL:
+		return map[string]any{"BOOL": v.Value}
+	case *types.AttributeValueMemberNULL:
+		return map[string]any{"NULL": v.Value}
+	case *types.AttributeValueMemberL:
+		list := make([]any, len(v.Value))
+		for i, element := range v.Value {
+			list[i] = rawAttributeValue(element)
+		}
+		return map[string]any{"L": list}
+	case *types.AttributeValueMemberM:
+		members := make(map[string]any, len(v.Value))
+		for name, element := range v.Value {
+			members[name] = rawAttributeValue(element)
+		}
+		return map[string]any{"M": members}
+	case *types.AttributeValueMemberSS:
+		return map[string]any{"SS": v.Value}
+	case *types.AttributeValueMemberNS:
+		return map[string]any{"NS": v.Value}
+	case *types.AttributeValueMemberBS:
+		return map[string]any{"BS": v.Value}
+	}
+	return map[string]any{"unknown": fmt.Sprintf("%T", value)}
+}
+
+// Seed modes. Overwrite writes every product with BatchWriteItem, replacing
+// existing items, so it only runs against an empty table. Missing first
+// scans the IDs already stored and writes only the others, so it is safe to
+// re-run against a partially or fully seeded table without clobbering edits.
+const (
+	SeedModeOverwrite = "overwrite"
+	SeedModeMissing   = "missing"
+)
+
+// ProductsTableEmpty decides whether the products table is empty, for the
+// seeding decision at startup, and explains how it decided. DescribeTable's
+// ItemCount is only refreshed every few hours, so a non-zero count settles
+// it but 0 just means "maybe empty": that is verified with a small strongly
+// consistent Scan, which can't return items whose deletion already completed.
+func ProductsTableEmpty(ctx context.Context) (bool, string, error) {
+	described, err := dynamoClient.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(productsTable),
+	})
+	if err != nil {
+		return false, "", fmt.Errorf("failed to describe %s: %v", productsTable, err)
+	}
+	if count := aws.ToInt64(described.Table.ItemCount); count > 0 {
+		return false, fmt.Sprintf("DescribeTable reports about %d items", count), nil
+	}
+
+	result, err := dynamoClient.Scan(ctx, &dynamodb.ScanInput{
+		TableName:            aws.String(productsTable),
+		ProjectionExpression: aws.String("product_id"),
+		ConsistentRead:       aws.Bool(true),
+		Limit:                aws.Int32(10),
+	})
+	if err != nil {
+		return false, "", fmt.Errorf("failed to scan %s: %v", productsTable, err)
+	}
+	if len(result.Items) > 0 || result.LastEvaluatedKey != nil {
+		return false, "DescribeTable reports 0 items (possibly stale) but a consistent scan found products", nil
+	}
+	return true, "DescribeTable reports 0 items and a consistent scan found none", nil
+}
+
+// existingProductIDs scans the IDs of every product stored in DynamoDB
+func existingProductIDs(ctx context.Context) (map[int]bool, error) {
+	input := &dynamodb.ScanInput{
+		TableName:            aws.String(productsTable),
+		ProjectionExpression: aws.String("product_id"),
+	}
+
+	ids := make(map[int]bool)
+	err := ParallelScan(ctx, input, scanSegments, func(items []map[string]types.AttributeValue) error {
+		var keys []struct {
+			ID int `dynamodbav:"product_id"`
+		}
+		if err := attributevalue.UnmarshalListOfMaps(items, &keys); err != nil {
+			return fmt.Errorf("failed to unmarshal product IDs: %v", err)
+		}
+		for _, key := range keys {
+			ids[key.ID] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan product IDs: %v", err)
+	}
+	return ids, nil
+}
+
+// SeedData populates DynamoDB with sample data using your existing GenerateProducts function.
+// With dryRun set nothing is written; it only reports how many items and
+// batches would be written and the write capacity units they'd consume.
+//
+// Cancelling ctx (e.g. on SIGTERM) stops seeding at the next batch boundary:
+// the batch in flight is allowed to finish so no batch is cut off midway.
+func SeedData(ctx context.Context, productsMap map[int]Item, dryRun bool) error {
+	log.Println("Seeding DynamoDB tables...")
+
+	// Batches run to completion even after ctx is cancelled
+	writeCtx := context.WithoutCancel(ctx)
+
+	// Skip products that already exist so their edits aren't overwritten
+	existing := map[int]bool{}
+	if seedMode == SeedModeMissing {
+		var err error
+		existing, err = existingProductIDs(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("Seeding only missing products, %d already exist", len(existing))
+	}
+
+	batchSize, delay := seedBatchSize, seedDelay
+	itemCount := 0
+	writeUnits := 0
+	seeded := 0 // products in batches written so far
+	log.Printf("Starting batch write to DynamoDB (batch size %d, delay %v)...", batchSize, delay)
+
+	// Convert map to slice and batch write (max 25 items per batch)
+	batchCount := 0
+	writeRequests := make([]types.WriteRequest, 0, batchSize)
+
+	writeBatch := func() {
+		if dryRun {
+			batchCount++
+			writeRequests = make([]types.WriteRequest, 0, batchSize)
+			return
+		}
+
+		// Pause between batches to stay within low provisioned capacity
+		if batchCount > 0 && delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+			}
+		}
+
+		_, err := dynamoClient.BatchWriteItem(writeCtx, &dynamodb.BatchWriteItemInput{
+			RequestItems: map[string][]types.WriteRequest{
+				productsTable: writeRequests,
+			},
+		})
+		if err != nil {
+			log.Printf("Warning: failed to batch write products: %v", err)
+		} else {
+			seeded += len(writeRequests)
+		}
+
+		batchCount++
+		if batchCount%100 == 0 {
+			log.Printf("Seeded %d batches...", batchCount)
+		}
+
+		// Reset for next batch
+		writeRequests = make([]types.WriteRequest, 0, batchSize)
+	}
+	
+	for _, product := range productsMap {
+		// Stop between batches once cancelled
+		if len(writeRequests) == 0 && ctx.Err() != nil {
+			log.Printf("Seeding cancelled after %d of %d products in %d batches", seeded, len(productsMap), batchCount)
+			return fmt.Errorf("seeding cancelled: %w", ctx.Err())
+		}
+
+		if existing[product.ID] {
+			continue
+		}
+
+		// Convert Item struct to DynamoDB ProductItem format (same structure, just with dynamodb tags)
+		dynamoProduct := productItemFromItem(product)
+		
+		item, err := marshalProduct(dynamoProduct)
+		if err != nil {
+			log.Printf("Warning: failed to marshal product %d: %v", product.ID, err)
+			continue
+		}
+
+		// A standard write consumes 1 WCU per 1KB of item size, rounded up
+		itemCount++
+		writeUnits += (estimateItemSize(item) + 1023) / 1024
+
+		writeRequests = append(writeRequests, types.WriteRequest{
+			PutRequest: &types.PutRequest{
+				Item: item,
+			},
+		})
+
+		// When the batch is full, write it
+		if len(writeRequests) == batchSize {
+			writeBatch()
+		}
+	}
+	
+	// Write any remaining items
+	if len(writeRequests) > 0 {
+		writeBatch()
+	}
+
+	if dryRun {
+		log.Printf("Dry run: would write %d products to %s in %d batches, consuming ~%d WCUs",
+			itemCount, productsTable, batchCount, writeUnits)
+		return nil
+	}
+
+	log.Printf("Database seeding completed! Seeded %d products in %d batches", seeded, batchCount)
+	return nil
+}
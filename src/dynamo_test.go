@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNowRFC3339IsUTC(t *testing.T) {
+	// Pretend the instance runs in a non-UTC zone
+	local := time.Local
+	time.Local = time.FixedZone("UTC-5", -5*60*60)
+	defer func() { time.Local = local }()
+
+	now := nowRFC3339()
+	if !strings.HasSuffix(now, "Z") {
+		t.Errorf("nowRFC3339() = %q, want a Z suffix", now)
+	}
+	if _, err := time.Parse(time.RFC3339, now); err != nil {
+		t.Errorf("nowRFC3339() = %q is not RFC3339: %v", now, err)
+	}
+}
+
+func TestAddQuantity(t *testing.T) {
+	limit := maxItemQuantity
+	maxItemQuantity = 1000
+	defer func() { maxItemQuantity = limit }()
+
+	tests := []struct {
+		name           string
+		current, added int
+		want           int
+		wantErr        bool
+	}{
+		{"new line", 0, 5, 5, false},
+		{"up to the cap", maxItemQuantity - 1, 1, maxItemQuantity, false},
+		{"over the cap", maxItemQuantity - 1, 2, 0, true},
+		{"would overflow int", 1, math.MaxInt, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := addQuantity(tt.current, tt.added)
+		if tt.wantErr {
+			if !errors.Is(err, ErrQuantityTooLarge) {
+				t.Errorf("%s: addQuantity(%d, %d) error = %v, want ErrQuantityTooLarge", tt.name, tt.current, tt.added, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: addQuantity(%d, %d) = %d, %v, want %d", tt.name, tt.current, tt.added, got, err, tt.want)
+		}
+	}
+}
+
+func TestApplyChangesToCartItemLimit(t *testing.T) {
+	limit, quantityLimit := maxCartItems, maxItemQuantity
+	maxCartItems, maxItemQuantity = 3, 1000
+	defer func() { maxCartItems, maxItemQuantity = limit, quantityLimit }()
+
+	products := map[int]*ProductItem{}
+	for id := 1; id <= maxCartItems+1; id++ {
+		products[id] = &ProductItem{ID: id, PriceCents: 100}
+	}
+
+	// One line short of the limit: a new product still fits
+	cart := &CartItem{Items: []CartProduct{{ID: 1, Quantity: 1}, {ID: 2, Quantity: 1}}}
+	changes := []cartChange{{productID: 3, quantity: 1}}
+	if err := applyChangesToCart(cart, changes, products); err != nil {
+		t.Fatalf("adding the last allowed line: %v", err)
+	}
+	if len(cart.Items) != maxCartItems || changes[0].action != CartActionAdded {
+		t.Fatalf("got %d lines and action %q, want %d lines and %q", len(cart.Items), changes[0].action, maxCartItems, CartActionAdded)
+	}
+
+	// At the limit: another product is rejected...
+	err := applyChangesToCart(cart, []cartChange{{productID: 4, quantity: 1}}, products)
+	if !errors.Is(err, ErrCartFull) {
+		t.Errorf("adding a line to a full cart: error = %v, want ErrCartFull", err)
+	}
+
+	// ...but existing lines can still grow
+	changes = []cartChange{{productID: 1, quantity: 2}}
+	if err := applyChangesToCart(cart, changes, products); err != nil {
+		t.Fatalf("incrementing a line in a full cart: %v", err)
+	}
+	if changes[0].action != CartActionIncremented || changes[0].newQuantity != 3 {
+		t.Errorf("got action %q quantity %d, want %q 3", changes[0].action, changes[0].newQuantity, CartActionIncremented)
+	}
+}
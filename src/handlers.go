@@ -1,19 +1,23 @@
 package main
 
 import (
+    "context"
+    "encoding/json"
+    "errors"
+    "io"
     "log"
     "net/http"
     "strconv"
     "time"
+    "math"
     "math/rand"
+    "runtime"
     "fmt"
     "strings"
-    "context"
+    "sort"
+    "slices"
+    "unicode/utf8"
     "github.com/gin-gonic/gin"
-    "github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
-    "github.com/aws/aws-sdk-go-v2/service/dynamodb"
-    "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-    "github.com/aws/aws-sdk-go-v2/aws"
 )
 
 // CartItem represents an item in the shopping cart
@@ -23,6 +27,10 @@ type CartItemResponse struct {
     Manufacturer string  `json:"manufacturer"`
     Category     string	 `json:"category"`
     Quantity    int     `json:"quantity"`
+    Product     *Item   `json:"product,omitempty"` // current product details, nil if the product no longer exists
+    Unavailable bool    `json:"unavailable,omitempty"` // product details were requested but couldn't be loaded
+    SubtotalCents *int  `json:"subtotal_cents,omitempty"` // current price x quantity, only with product details
+    Subtotal    string  `json:"subtotal,omitempty"`       // SubtotalCents for display, e.g. "$12.34"
     CreatedAt   string  `json:"created_at"`
     UpdatedAt   string  `json:"updated_at"`
 }
@@ -34,6 +42,270 @@ type ShoppingCartResponse struct {
     Items      []CartItemResponse `json:"items"`
     CreatedAt  string     `json:"created_at"`
     UpdatedAt  string     `json:"updated_at"`
+    ExpiresAt  int64      `json:"expires_at,omitempty"` // epoch seconds, omitted for wishlists
+    PromoCode  string     `json:"promo_code,omitempty"`
+    Name       string     `json:"name,omitempty"`
+    Notes      string     `json:"notes,omitempty"`
+}
+
+// Cart response formats (format)
+const (
+    cartFormatNested = "nested" // ShoppingCartResponse, lines nested under items
+    cartFormatFlat   = "flat"   // FlatCartResponse
+)
+
+// FlatCartResponse is a cart with no nesting below its two top-level fields,
+// for clients that can't handle nested objects:
+//
+//  {"meta": {"id": 1, "customer_id": 1, ..., "line_count": 2},
+//   "line_items": [{"id": 1, "product_id": 7, "quantity": 2, "product_name": ..., "price_cents": ...}, ...]}
+type FlatCartResponse struct {
+    Meta      FlatCartMeta   `json:"meta"`
+    LineItems []FlatCartLine `json:"line_items"`
+}
+
+// FlatCartMeta holds the cart-level fields of a FlatCartResponse
+type FlatCartMeta struct {
+    ID         int    `json:"id"`
+    CustomerID int    `json:"customer_id"`
+    CreatedAt  string `json:"created_at"`
+    UpdatedAt  string `json:"updated_at"`
+    ExpiresAt  int64  `json:"expires_at,omitempty"`
+    PromoCode  string `json:"promo_code,omitempty"`
+    Name       string `json:"name,omitempty"`
+    Notes      string `json:"notes,omitempty"`
+    LineCount  int    `json:"line_count"`
+}
+
+// FlatCartLine is a CartItemResponse with the expanded product's fields
+// inlined under a product_ prefix (price_cents being the product's price)
+type FlatCartLine struct {
+    ID            int     `json:"id"`
+    ProductID     int     `json:"product_id"`
+    Manufacturer  string  `json:"manufacturer"`
+    Category      string  `json:"category"`
+    Quantity      int     `json:"quantity"`
+    ProductSKU    string  `json:"product_sku,omitempty"`
+    ProductName   string  `json:"product_name,omitempty"`
+    ProductBrand  string  `json:"product_brand,omitempty"`
+    ProductWeight float64 `json:"product_weight,omitempty"`
+    PriceCents    *int    `json:"price_cents,omitempty"`
+    SubtotalCents *int    `json:"subtotal_cents,omitempty"`
+    Subtotal      string  `json:"subtotal,omitempty"`
+    Unavailable   bool    `json:"unavailable,omitempty"`
+}
+
+// flattenCart converts a nested cart response to the flat format
+func flattenCart(cart ShoppingCartResponse) FlatCartResponse {
+    flat := FlatCartResponse{
+        Meta: FlatCartMeta{
+            ID:         cart.ID,
+            CustomerID: cart.CustomerID,
+            CreatedAt:  cart.CreatedAt,
+            UpdatedAt:  cart.UpdatedAt,
+            ExpiresAt:  cart.ExpiresAt,
+            PromoCode:  cart.PromoCode,
+            Name:       cart.Name,
+            Notes:      cart.Notes,
+            LineCount:  len(cart.Items),
+        },
+        LineItems: make([]FlatCartLine, 0, len(cart.Items)),
+    }
+    for _, item := range cart.Items {
+        line := FlatCartLine{
+            ID:            item.ID,
+            ProductID:     item.ProductID,
+            Manufacturer:  item.Manufacturer,
+            Category:      item.Category,
+            Quantity:      item.Quantity,
+            SubtotalCents: item.SubtotalCents,
+            Subtotal:      item.Subtotal,
+            Unavailable:   item.Unavailable,
+        }
+        if product := item.Product; product != nil {
+            line.ProductSKU = product.SKU
+            line.ProductName = product.Name
+            line.ProductBrand = product.Brand
+            line.ProductWeight = product.Weight
+            // Lines of unpriced products have no subtotal, and no price either
+            if item.SubtotalCents != nil {
+                price := product.PriceCents
+                line.PriceCents = &price
+            }
+        }
+        flat.LineItems = append(flat.LineItems, line)
+    }
+    return flat
+}
+
+// writeCart responds with the cart in the requested format
+func writeCart(c *gin.Context, format string, cart ShoppingCartResponse) {
+    if format == cartFormatFlat {
+        c.JSON(http.StatusOK, flattenCart(cart))
+        return
+    }
+    c.JSON(http.StatusOK, cart)
+}
+
+// productCacheControl is the Cache-Control value of successful product reads
+var productCacheControl = "no-cache"
+
+// defaultCartQuantity is added when an add-to-cart request omits quantity (DEFAULT_CART_QUANTITY)
+var defaultCartQuantity = 1
+
+// taxRate is applied to cart subtotals, e.g. 0.0725 for 7.25% (TAX_RATE)
+var taxRate float64
+
+// ShippingTier charges CostCents for a cart weighing up to MaxWeight
+type ShippingTier struct {
+    MaxWeight float64
+    CostCents int
+}
+
+// shippingRates are the tiers of shipping estimates, ascending by MaxWeight (SHIPPING_RATES)
+var shippingRates = defaultShippingRates
+
+// defaultShippingRates is used when SHIPPING_RATES is unset
+var defaultShippingRates = []ShippingTier{
+    {MaxWeight: 1, CostCents: 499},
+    {MaxWeight: 5, CostCents: 899},
+    {MaxWeight: 20, CostCents: 1499},
+    {MaxWeight: 50, CostCents: 2499},
+}
+
+// shippingCost is the cost of the first tier that fits weight. Carts heavier
+// than the last tier pay its cost, and an empty cart ships free.
+func shippingCost(weight float64, tiers []ShippingTier) int {
+    if weight <= 0 || len(tiers) == 0 {
+        return 0
+    }
+    for _, tier := range tiers {
+        if weight <= tier.MaxWeight {
+            return tier.CostCents
+        }
+    }
+    return tiers[len(tiers)-1].CostCents
+}
+
+
+// ShippingEstimateResponse is the estimated shipping of a cart by weight
+type ShippingEstimateResponse struct {
+    CustomerID     int     `json:"customer_id"`
+    TotalWeight    float64 `json:"total_weight"` // sum of weight x quantity, in product weight units
+    ShippingCents  int     `json:"shipping_cents"`
+    Shipping       string  `json:"shipping"`        // ShippingCents formatted as dollars
+    UnweighedItems []int   `json:"unweighed_items"` // product IDs that no longer exist, excluded from the weight
+}
+
+// CartTotalResponse is the price breakdown of a cart, in cents
+type CartTotalResponse struct {
+    CustomerID      int     `json:"customer_id"`
+    SubtotalCents   int     `json:"subtotal_cents"`
+    PromoCode       string  `json:"promo_code,omitempty"`
+    PromoIssue      string  `json:"promo_issue,omitempty"` // why the applied promo gave no discount, e.g. it expired
+    DiscountCents   int     `json:"discount_cents"`
+    TaxRate         float64 `json:"tax_rate"`
+    TaxCents        int     `json:"tax_cents"`
+    TotalCents      int     `json:"total_cents"`
+    UnpricedItems   []int   `json:"unpriced_items"` // product IDs that no longer exist or have no price, excluded from the total
+}
+
+// parseIntParam reads a path parameter that must be a positive integer, such
+// as a customer or product ID. On failure it responds 400 with the same error
+// on every endpoint and returns false; the handler should then just return.
+func parseIntParam(c *gin.Context, name string) (int, bool) {
+    raw := c.Param(name)
+    value, err := strconv.Atoi(raw)
+    if err != nil || value < 1 {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":   "INVALID_INPUT",
+            "message": fmt.Sprintf("invalid %s", name),
+            "details": fmt.Sprintf("%s must be a positive integer, got %q", name, raw),
+        })
+        return 0, false
+    }
+    return value, true
+}
+
+// JSONPosition locates where a request body failed to decode
+type JSONPosition struct {
+    Offset int64  `json:"offset"`          // bytes into the body
+    Field  string `json:"field,omitempty"` // dotted path of the mistyped field, if any
+}
+
+// describeJSONError explains a ShouldBindJSON failure caused by a body that
+// isn't valid JSON or has a value of the wrong type, and where it happened.
+// ok is false for anything else, e.g. a failed binding rule, which callers
+// report as before. pos is nil when the body simply ended too early.
+func describeJSONError(err error) (reason string, pos *JSONPosition, ok bool) {
+    var syntaxErr *json.SyntaxError
+    var typeErr *json.UnmarshalTypeError
+    switch {
+    case errors.As(err, &syntaxErr):
+        return fmt.Sprintf("malformed JSON at offset %d: %v", syntaxErr.Offset, syntaxErr),
+            &JSONPosition{Offset: syntaxErr.Offset}, true
+    case errors.As(err, &typeErr):
+        return fmt.Sprintf("%s must be %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value),
+            &JSONPosition{Offset: typeErr.Offset, Field: typeErr.Field}, true
+    case errors.Is(err, io.ErrUnexpectedEOF):
+        return "malformed JSON: unexpected end of body", nil, true
+    }
+    return "", nil, false
+}
+
+// writeCartBindError answers a failed ShouldBindJSON in the cart handlers'
+// error style, explaining malformed JSON (see describeJSONError) and
+// otherwise reporting fallback
+func writeCartBindError(c *gin.Context, err error, fallback string) {
+    if reason, pos, ok := describeJSONError(err); ok {
+        c.JSON(http.StatusBadRequest, gin.H{"error": reason, "position": pos})
+        return
+    }
+    c.JSON(http.StatusBadRequest, gin.H{
+        "error": fallback,
+    })
+}
+
+// writeProductBindError answers a failed ShouldBindJSON in the product
+// handlers' INVALID_INPUT style, explaining malformed JSON (see
+// describeJSONError) and otherwise giving details, usually err.Error() since
+// it tells why decoding failed, e.g. a missing field
+func writeProductBindError(c *gin.Context, err error, details string) {
+    if reason, pos, ok := describeJSONError(err); ok {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":    "INVALID_INPUT",
+            "message":  "The request body is not valid JSON",
+            "details":  reason,
+            "position": pos,
+        })
+        return
+    }
+    c.JSON(http.StatusBadRequest, gin.H{
+        "error":   "INVALID_INPUT",
+        "message": "The provided input data is invalid",
+        "details": details,
+    })
+}
+
+// setProductCacheHeaders lets browsers and CDNs cache a product read. Only
+// successful responses are marked cacheable, errors are left uncached.
+func setProductCacheHeaders(c *gin.Context) {
+    c.Header("Cache-Control", productCacheControl)
+}
+
+// Cart validation issue types
+const (
+    IssueProductRemoved    = "product_removed"
+    IssueInsufficientStock = "insufficient_stock"
+    IssueProductChanged    = "product_changed" // manufacturer/category differ from when it was added
+    IssuePriceChanged      = "price_changed"   // price differs from when it was added
+)
+
+// CartIssue describes one cart line that would fail checkout
+type CartIssue struct {
+    ProductID int    `json:"product_id"`
+    Type      string `json:"type"`
+    Message   string `json:"message"`
 }
 
 // createShoppingCart creates a new shopping cart
@@ -44,55 +316,40 @@ func createShoppingCart(c *gin.Context) {
     }
     
     if err := c.ShouldBindJSON(&input); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{
-            "error": "customer_id is required",
-        })
+        writeCartBindError(c, err, "customer_id is required")
         return
     }
     
-    // Try to get existing cart from DynamoDB
-    ctx := context.Background()
-    result, err := dynamoClient.GetItem(ctx, &dynamodb.GetItemInput{
-        TableName: aws.String(cartsTable),
-        Key: map[string]types.AttributeValue{
-            "customer_id": &types.AttributeValueMemberN{Value: strconv.Itoa(input.CustomerID)},
-        },
-    })
-    
-    // If cart exists in DynamoDB, return message
-    if err == nil && result.Item != nil {
-        c.JSON(http.StatusOK, gin.H{
-            "message":     "Shopping cart already exists for this customer",
-            "id":          input.CustomerID,
-            "customer_id": input.CustomerID,
+    // Try to get existing cart (expired carts count as missing)
+    ctx := c.Request.Context()
+    _, err := store.GetCart(ctx, input.CustomerID)
+    if err != nil && !errors.Is(err, ErrCartNotFound) {
+        // Creating now could overwrite a cart the read failed to return
+        log.Printf("Error retrieving cart: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
         })
         return
     }
     
-    // Create and save new empty cart to DynamoDB
-    newCart := &CartItem{
-        CustomerID: input.CustomerID,
-        Items:      []CartProduct{},
-        CreatedAt:  time.Now().Format(time.RFC3339),
-        UpdatedAt:  time.Now().Format(time.RFC3339),
+    // Create and save new empty cart, unless the customer already has one
+    // (CreateCart also catches a cart the read above missed)
+    exists := err == nil
+    var newCart *CartItem
+    if !exists {
+        newCart, err = store.CreateCart(ctx, input.CustomerID)
+        exists = errors.Is(err, ErrCartExists)
     }
-    
-    // Marshal and save to DynamoDB
-    item, err := attributevalue.MarshalMap(newCart)
-    if err != nil {
-        log.Printf("Error marshaling cart: %v", err)
-        c.JSON(http.StatusInternalServerError, gin.H{
-            "error": "Failed to create cart",
+    if exists {
+        c.JSON(http.StatusOK, gin.H{
+            "message":     "Shopping cart already exists for this customer",
+            "id":          input.CustomerID,
+            "customer_id": input.CustomerID,
         })
         return
     }
-    
-    _, err = dynamoClient.PutItem(ctx, &dynamodb.PutItemInput{
-        TableName: aws.String(cartsTable),
-        Item:      item,
-    })
     if err != nil {
-        log.Printf("Error saving cart to DynamoDB: %v", err)
+        log.Printf("Error saving cart: %v", err)
         c.JSON(http.StatusInternalServerError, gin.H{
             "error": "Failed to create cart",
         })
@@ -105,25 +362,38 @@ func createShoppingCart(c *gin.Context) {
         "customer_id": input.CustomerID,
         "message":     fmt.Sprintf("shopping cart created for customer %d", input.CustomerID),
         "created_at":  newCart.CreatedAt,
+        "expires_at":  newCart.ExpiresAt,
     })
 }
 
-// getShoppingCart retrieves a shopping cart with all items by customer ID
-// GET /shopping-carts/:id (where id is customer_id)
+// getShoppingCart retrieves a shopping cart with all items by customer ID.
+// With ?expand=products each line also carries the current product and its
+// priced subtotal. By default the response is a ShoppingCartResponse, with
+// ?format=flat a FlatCartResponse.
+// GET /shopping-carts/:id?expand=products&format={nested|flat} (where id is customer_id)
 func getShoppingCart(c *gin.Context) {
-    customerIDParam := c.Param("id")
-    
-    // Convert to integer
-    customerID, err := strconv.Atoi(customerIDParam)
-    if err != nil {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
+        return
+    }
+
+    expand := c.Query("expand")
+    if expand != "" && expand != "products" {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": "expand must be \"products\"",
+        })
+        return
+    }
+    format := c.DefaultQuery("format", cartFormatNested)
+    if format != cartFormatNested && format != cartFormatFlat {
         c.JSON(http.StatusBadRequest, gin.H{
-            "error": "Invalid customer ID",
+            "error": "format must be nested or flat",
         })
         return
     }
     
     // Get cart from DynamoDB
-    cart, err := GetCart(customerID)
+    cart, err := store.GetCart(c.Request.Context(), customerID)
     if err != nil {
         log.Printf("Error retrieving cart: %v", err)
         c.JSON(http.StatusInternalServerError, gin.H{
@@ -132,219 +402,2167 @@ func getShoppingCart(c *gin.Context) {
         return
     }
     
-    // Convert DynamoDB cart to response format
-    response := ShoppingCartResponse{
-        ID:         customerID, // Using customer_id as cart ID
-        CustomerID: cart.CustomerID,
-        CreatedAt:  cart.CreatedAt,
-        UpdatedAt:  cart.UpdatedAt,
-        Items:      []CartItemResponse{},
-    }
-    
-    // Convert cart items to response format
-    for i, item := range cart.Items {
-        response.Items = append(response.Items, CartItemResponse{
-            ID:           i + 1, // Generate sequential IDs for items
-            ProductID:    item.ID,
-            Manufacturer: item.Manufacturer, // Map name to manufacturer for compatibility
-            Category:     item.Category, // Map description to category for compatibility
-            Quantity:     item.Quantity,
-            CreatedAt:    cart.CreatedAt,
-            UpdatedAt:    cart.UpdatedAt,
-        })
+    // Last-Modified lets pollers revalidate with If-Modified-Since. It only
+    // tracks cart writes, so expanded responses (which include live product
+    // data) are never answered with 304.
+    if updatedAt, err := time.Parse(time.RFC3339, cart.UpdatedAt); err == nil {
+        c.Header("Last-Modified", updatedAt.UTC().Format(http.TimeFormat))
+        if since, err := http.ParseTime(c.GetHeader("If-Modified-Since")); err == nil && expand == "" &&
+            !updatedAt.Truncate(time.Second).After(since) {
+            c.Status(http.StatusNotModified)
+            return
+        }
     }
-    
-    // Return the cart with all items
-    c.JSON(http.StatusOK, response)
-}
 
-// addItemToCart adds or updates an item in the shopping cart by customer ID
-// POST /shopping-carts/:id/items (where id is customer_id)
-func addItemToCart(c *gin.Context) {
-    customerIDParam := c.Param("id")
-    
-    // Convert to integer
-    customerID, err := strconv.Atoi(customerIDParam)
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{
-            "error": "Invalid customer ID",
-        })
+    // Product details are opt-in (?expand=products) since they cost extra reads
+    if expand != "products" {
+        writeCart(c, format, buildCartResponse(cart, nil))
         return
     }
-    
-    // Parse request body
-    var input struct {
-        ProductID int `json:"product_id" binding:"required"`
-        Quantity  int `json:"quantity" binding:"required,min=1"`
+
+    // Batch-fetch current product details so the cart reflects live product data
+    productIDs := make([]int, 0, len(cart.Items))
+    for _, item := range cart.Items {
+        productIDs = append(productIDs, item.ID)
+    }
+    products, err := store.GetProductsAllowStale(c.Request.Context(), productIDs)
+    switch {
+    case errors.Is(err, ErrProductUndecodable):
+        // Still serve the cart: the products that couldn't be decoded are
+        // marked unavailable below
+        log.Printf("Error decoding cart products: %v", err)
+    case err != nil:
+        // Still serve the cart: every line is marked unavailable instead
+        log.Printf("Error retrieving cart products: %v", err)
+        products = map[int]*ProductItem{}
+    }
+    var missing []int
+    for _, id := range productIDs {
+        if _, ok := products[id]; !ok {
+            missing = append(missing, id)
+        }
+    }
+    if len(missing) > 0 {
+        log.Printf("Warning: cart %d references unavailable products %v", customerID, missing)
     }
     
-    if err := c.ShouldBindJSON(&input); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{
-            "error": "product_id and quantity (min 1) are required",
-        })
+    // Return the cart with all items, unavailable ones included
+    writeCart(c, format, buildCartResponse(cart, products))
+}
+
+// validateShoppingCart checks every cart line against current product state
+// without modifying anything
+// POST /shopping-carts/:id/validate
+func validateShoppingCart(c *gin.Context) {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
         return
     }
-    
-    // Verify product exists in DynamoDB
-    product, err := GetProduct(input.ProductID)
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{
-            "error": "Product not found",
+
+    cart, err := store.GetCart(c.Request.Context(), customerID)
+    if errors.Is(err, ErrCartNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{
+            "error": "Cart not found",
         })
         return
     }
-    
-    // Add item to cart using DynamoDB function
-    err = AddToCart(customerID, input.ProductID, input.Quantity)
     if err != nil {
-        log.Printf("Error adding item to cart: %v", err)
+        log.Printf("Error retrieving cart: %v", err)
         c.JSON(http.StatusInternalServerError, gin.H{
-            "error": "Failed to add item to cart",
+            "error": "Internal server error",
         })
         return
     }
-    
-    // Get updated cart to return
-    cart, err := GetCart(customerID)
+
+    productIDs := make([]int, 0, len(cart.Items))
+    for _, item := range cart.Items {
+        productIDs = append(productIDs, item.ID)
+    }
+    products, err := store.GetProducts(c.Request.Context(), productIDs)
     if err != nil {
-        log.Printf("Error retrieving updated cart: %v", err)
-        c.JSON(http.StatusOK, gin.H{
-            "message":    "Item added to cart",
-            "product_id": input.ProductID,
-            "quantity":   input.Quantity,
+        log.Printf("Error retrieving cart products: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
         })
         return
     }
-    
-    // Find the added/updated item in the cart
-    var addedItem CartItemResponse
-    for i, item := range cart.Items {
-        if item.ID == input.ProductID {
-            addedItem = CartItemResponse{
-                ID:           i + 1,
-                ProductID:    item.ID,
-                Manufacturer: product.Manufacturer,
-                Category:     product.Category,
-                Quantity:     item.Quantity,
-                CreatedAt:    cart.CreatedAt,
-                UpdatedAt:    cart.UpdatedAt,
-            }
-            break
+
+    issues := []CartIssue{}
+    for _, item := range cart.Items {
+        product, ok := products[item.ID]
+        switch {
+        case !ok:
+            issues = append(issues, CartIssue{
+                ProductID: item.ID,
+                Type:      IssueProductRemoved,
+                Message:   "product no longer exists",
+            })
+        // Stock the line has reserved is held for it, on top of what's available
+        case product.Stock+item.Reserved < item.Quantity:
+            issues = append(issues, CartIssue{
+                ProductID: item.ID,
+                Type:      IssueInsufficientStock,
+                Message:   fmt.Sprintf("requested %d, only %d in stock", item.Quantity, product.Stock+item.Reserved),
+            })
+        case product.Manufacturer != item.Manufacturer || product.Category != item.Category:
+            issues = append(issues, CartIssue{
+                ProductID: item.ID,
+                Type:      IssueProductChanged,
+                Message:   "product details changed since it was added to the cart",
+            })
+        // Lines without a recorded price can't be compared
+        case item.PriceCents != nil && !product.Unpriced && product.PriceCents != *item.PriceCents:
+            issues = append(issues, CartIssue{
+                ProductID: item.ID,
+                Type:      IssuePriceChanged,
+                Message:   fmt.Sprintf("price changed from %s to %s since it was added to the cart", formatCents(*item.PriceCents), formatCents(product.PriceCents)),
+            })
         }
     }
-    
+
     c.JSON(http.StatusOK, gin.H{
-        "message": "Item added to cart successfully",
-        "item":    addedItem,
+        "valid":  len(issues) == 0,
+        "issues": issues,
     })
 }
 
-func searchProducts(c *gin.Context) {
-    defer func() {
-        if r := recover(); r != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{
-                "error":   "INTERNAL_SERVER_ERROR",
-                "message": "something went wrong",
-                "details": fmt.Sprintf("%v", r),
-            })
-        }
-    }()
-    startTime := time.Now()
-
-    // Extract query parameter
-    query := c.Query("q")
-    if query == "" {
-        c.JSON(400, gin.H{"error": "Query parameter 'q' is required"})
+// getCartTotal prices a cart from current product prices
+// GET /shopping-carts/:id/total
+func getCartTotal(c *gin.Context) {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
         return
     }
-    // Convert query to lowercase for case-insensitive search
-    queryLower := strings.ToLower(query)
 
-    // Generate 100 random product IDs (1-100000)
-    randomIDs := generateRandomIDs(100, 1, 100000)
+    cart, err := store.GetCart(c.Request.Context(), customerID)
+    if errors.Is(err, ErrCartNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{
+            "error": "Cart not found",
+        })
+        return
+    }
+    if err != nil {
+        log.Printf("Error retrieving cart: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
+        })
+        return
+    }
 
-    // Search for matching products
-    var matchingProducts []Item
-    totalFound := 0
-    totalSearched := 0
+    productIDs := make([]int, 0, len(cart.Items))
+    for _, item := range cart.Items {
+        productIDs = append(productIDs, item.ID)
+    }
+    products, err := store.GetProductsAllowStale(c.Request.Context(), productIDs)
+    if err != nil {
+        log.Printf("Error retrieving cart products: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
+        })
+        return
+    }
 
-    for _, productID := range randomIDs {
-        // Check if product exists in map
-        totalSearched++
-        if value, exists := syncProducts.Load(productID); exists {
-            // Check if query matches name, category, or brand (case-insensitive)
-            item := value.(Item)
-            nameLower := strings.ToLower(item.Name)
-            categoryLower := strings.ToLower(item.Category)
-            brandLower := strings.ToLower(item.Brand)
-
-            if strings.Contains(nameLower, queryLower) ||
-                strings.Contains(categoryLower, queryLower) ||
-                strings.Contains(brandLower, queryLower) {
-
-                totalFound++
-
-                // Add to results if we haven't reached 20 items yet
-                if len(matchingProducts) < 20 {
-                    matchingProducts = append(matchingProducts, item)
-                }
-            }
+    prices := make(map[int]int, len(products))
+    unpriced := []int{}
+    for _, item := range cart.Items {
+        product, ok := products[item.ID]
+        if !ok || product.Unpriced {
+            unpriced = append(unpriced, item.ID)
+            continue
         }
+        prices[item.ID] = product.PriceCents
     }
 
-    // Calculate search duration
-    duration := time.Since(startTime)
-    searchTime := fmt.Sprintf("%.3fs", duration.Seconds())
-
-    // Create response
-    response := SearchResponse{
-        Products:      matchingProducts,
-        TotalFound:    totalFound,
-        TotalSearched: totalSearched,
-        SearchTime:    searchTime,
-    }
+    total := cartTotal(cart, prices, unpriced, nil)
 
-    // Return empty array instead of null if no products found
-    if response.Products == nil {
-        response.Products = []Item{}
+    // A promo that was valid when applied may have expired or been removed
+    // since; the total then shows why it no longer discounts anything
+    if cart.PromoCode != "" {
+        promo, err := GetPromo(c.Request.Context(), cart.PromoCode)
+        switch {
+        case err == nil && promo.Expired(time.Now()):
+            total.PromoIssue = ErrPromoExpired.Error()
+        case err == nil:
+            total = cartTotal(cart, prices, unpriced, promo)
+        case errors.Is(err, ErrPromoNotFound), errors.Is(err, ErrPromosDisabled):
+            total.PromoIssue = err.Error()
+        default:
+            log.Printf("Error retrieving promo: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{
+                "error": "Internal server error",
+            })
+            return
+        }
     }
 
-    c.JSON(200, response)
+    c.JSON(http.StatusOK, total)
 }
 
-// generateRandomIDs generates n random integers between min and max (inclusive)
-func generateRandomIDs(n, min, max int) []int {
-    ids := make([]int, n)
-    for i := 0; i < n; i++ {
-        ids[i] = rand.Intn(max-min+1) + min
+// cartTotal computes the price breakdown of a cart, applying promo (may be
+// nil) to the subtotal before tax. Tax is rounded half up to the nearest cent.
+func cartTotal(cart *CartItem, prices map[int]int, unpriced []int, promo *Promo) CartTotalResponse {
+    subtotal := ComputeCartTotal(cart, prices)
+    discount := 0
+    if promo != nil {
+        discount = promo.Discount(subtotal)
+    }
+    tax := int(math.Round(float64(subtotal-discount) * taxRate))
+    return CartTotalResponse{
+        CustomerID:    cart.CustomerID,
+        SubtotalCents: subtotal,
+        PromoCode:     cart.PromoCode,
+        DiscountCents: discount,
+        TaxRate:       taxRate,
+        TaxCents:      tax,
+        TotalCents:    subtotal - discount + tax,
+        UnpricedItems: unpriced,
     }
-    return ids
 }
 
-// postAlbums adds an album from JSON received in the request body.
-func postItem(c *gin.Context) {
-
-    defer func() {
-        if r := recover(); r != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{
-                "error":   "INTERNAL_SERVER_ERROR",
-                "message": "something went wrong",
-                "details": fmt.Sprintf("%v", r),
-            })
-        }
-    }()
+// getCartShipping estimates a cart's shipping cost from the total weight of
+// its items and the SHIPPING_RATES tiers
+// GET /shopping-carts/:id/shipping
+func getCartShipping(c *gin.Context) {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
+        return
+    }
 
-    // Extract product ID from route
-    productIDStr := c.Param("productId")
-    productID, err := strconv.Atoi(productIDStr)
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{
-            "error":   "INVALID_INPUT",
+    cart, err := store.GetCart(c.Request.Context(), customerID)
+    if errors.Is(err, ErrCartNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{
+            "error": "Cart not found",
+        })
+        return
+    }
+    if err != nil {
+        log.Printf("Error retrieving cart: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
+        })
+        return
+    }
+
+    productIDs := make([]int, 0, len(cart.Items))
+    for _, item := range cart.Items {
+        productIDs = append(productIDs, item.ID)
+    }
+    products, err := store.GetProductsAllowStale(c.Request.Context(), productIDs)
+    if err != nil {
+        log.Printf("Error retrieving cart products: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
+        })
+        return
+    }
+
+    weight := 0.0
+    unweighed := []int{}
+    for _, item := range cart.Items {
+        product, ok := products[item.ID]
+        if !ok {
+            unweighed = append(unweighed, item.ID)
+            continue
+        }
+        weight += product.Weight * float64(item.Quantity)
+    }
+    // Weights are stored to one decimal place, don't report float noise
+    weight = math.Round(weight*10) / 10
+
+    cost := shippingCost(weight, shippingRates)
+    c.JSON(http.StatusOK, ShippingEstimateResponse{
+        CustomerID:     customerID,
+        TotalWeight:    weight,
+        ShippingCents:  cost,
+        Shipping:       formatCents(cost),
+        UnweighedItems: unweighed,
+    })
+}
+
+// applyCartPromo validates a promo code and stores it on the cart
+// POST /shopping-carts/:id/promo with {"code": "..."}
+func applyCartPromo(c *gin.Context) {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
+        return
+    }
+
+    var input struct {
+        Code string `json:"code" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        writeCartBindError(c, err, "code is required")
+        return
+    }
+
+    promo, err := GetPromo(c.Request.Context(), input.Code)
+    switch {
+    case errors.Is(err, ErrPromosDisabled):
+        c.JSON(http.StatusServiceUnavailable, gin.H{
+            "error": err.Error(),
+        })
+        return
+    case errors.Is(err, ErrPromoNotFound):
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": ErrPromoNotFound.Error(),
+        })
+        return
+    case err != nil:
+        log.Printf("Error retrieving promo: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
+        })
+        return
+    case promo.Expired(time.Now()):
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": ErrPromoExpired.Error(),
+        })
+        return
+    }
+
+    cart, err := SetCartPromo(c.Request.Context(), customerID, promo.Code)
+    writeCartPromoResponse(c, cart, err)
+}
+
+// removeCartPromo clears the cart's applied promo. It is idempotent: a cart
+// without a promo is returned unchanged with 200 rather than 404, so retries
+// are safe. Totals are computed on read, so GET .../total reflects it at once.
+// DELETE /shopping-carts/:id/promo
+func removeCartPromo(c *gin.Context) {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
+        return
+    }
+
+    cart, err := store.GetCart(c.Request.Context(), customerID)
+    if err == nil && cart.PromoCode != "" {
+        cart, err = SetCartPromo(c.Request.Context(), customerID, "")
+    }
+    writeCartPromoResponse(c, cart, err)
+}
+
+// writeCartPromoResponse returns the cart after a promo change, or maps the error
+func writeCartPromoResponse(c *gin.Context, cart *CartItem, err error) {
+    switch {
+    case errors.Is(err, ErrCartNotFound):
+        c.JSON(http.StatusNotFound, gin.H{
+            "error": "Cart not found",
+        })
+    case errors.Is(err, ErrCartConflict):
+        c.JSON(http.StatusConflict, gin.H{
+            "error": err.Error(),
+        })
+    case err != nil:
+        log.Printf("Error updating cart promo: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
+        })
+    default:
+        c.JSON(http.StatusOK, buildCartResponse(cart, nil))
+    }
+}
+
+// Limits on cart labels, in characters
+const (
+    maxCartNameLength  = 100
+    maxCartNotesLength = 1000
+)
+
+// patchShoppingCart updates a cart's name and notes without touching its
+// items. Fields absent from the body are left as they are.
+// PATCH /shopping-carts/:id with {"name": "...", "notes": "..."}
+func patchShoppingCart(c *gin.Context) {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
+        return
+    }
+
+    var metadata CartMetadata
+    if err := c.ShouldBindJSON(&metadata); err != nil {
+        writeCartBindError(c, err, "name or notes is required")
+        return
+    }
+    switch {
+    case metadata.Name == nil && metadata.Notes == nil:
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": "name or notes is required",
+        })
+        return
+    case metadata.Name != nil && utf8.RuneCountInString(*metadata.Name) > maxCartNameLength:
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": fmt.Sprintf("name must be at most %d characters", maxCartNameLength),
+        })
+        return
+    case metadata.Notes != nil && utf8.RuneCountInString(*metadata.Notes) > maxCartNotesLength:
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": fmt.Sprintf("notes must be at most %d characters", maxCartNotesLength),
+        })
+        return
+    }
+
+    cart, err := store.UpdateCartMetadata(c.Request.Context(), customerID, metadata)
+    if errors.Is(err, ErrCartNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{
+            "error": "Cart not found",
+        })
+        return
+    }
+    if err != nil {
+        log.Printf("Error updating cart metadata: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
+        })
+        return
+    }
+
+    c.JSON(http.StatusOK, buildCartResponse(cart, nil))
+}
+
+// buildCartResponse converts a DynamoDB cart to its response format. Items are
+// enriched with product details when they are present in products (may be nil);
+// with a non-nil products, lines missing from it are marked unavailable.
+func buildCartResponse(cart *CartItem, products map[int]*ProductItem) ShoppingCartResponse {
+    response := ShoppingCartResponse{
+        ID:         cart.CustomerID, // Using customer_id as cart ID
+        CustomerID: cart.CustomerID,
+        CreatedAt:  cart.CreatedAt,
+        UpdatedAt:  cart.UpdatedAt,
+        ExpiresAt:  cart.ExpiresAt,
+        PromoCode:  cart.PromoCode,
+        Name:       cart.Name,
+        Notes:      cart.Notes,
+        Items:      []CartItemResponse{},
+    }
+    
+    // Sort by product_id so ordering and the synthetic line IDs are stable
+    // across reads, regardless of the stored order
+    items := slices.Clone(cart.Items)
+    sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+    
+    // Convert cart items to response format
+    for i, item := range items {
+        line := CartItemResponse{
+            ID:           i + 1, // Generate sequential IDs for items
+            ProductID:    item.ID,
+            Manufacturer: item.Manufacturer, // Map name to manufacturer for compatibility
+            Category:     item.Category, // Map description to category for compatibility
+            Quantity:     item.Quantity,
+            CreatedAt:    cart.CreatedAt,
+            UpdatedAt:    cart.UpdatedAt,
+        }
+        if product, ok := products[item.ID]; ok {
+            details := product.ToItem()
+            line.Product = &details
+            if !product.Unpriced {
+                subtotal := product.PriceCents * item.Quantity
+                line.SubtotalCents = &subtotal
+                line.Subtotal = formatCents(subtotal)
+            }
+        } else if products != nil {
+            line.Unavailable = true
+        }
+        response.Items = append(response.Items, line)
+    }
+    
+    return response
+}
+
+// formatCents renders an amount in cents as dollars, e.g. 1234 -> "$12.34"
+func formatCents(cents int) string {
+    sign := ""
+    if cents < 0 {
+        sign, cents = "-", -cents
+    }
+    return fmt.Sprintf("%s$%d.%02d", sign, cents/100, cents%100)
+}
+
+// maxBatchCarts caps the number of customer IDs per batch cart request
+const maxBatchCarts = 500
+
+// listShoppingCarts pages through all carts for admin tooling
+// GET /shopping-carts?limit={n}&cursor={cursor}
+func listShoppingCarts(c *gin.Context) {
+    limit := 25
+    if limitParam := c.Query("limit"); limitParam != "" {
+        parsed, err := strconv.Atoi(limitParam)
+        if err != nil || parsed < 1 || parsed > 100 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+            return
+        }
+        limit = parsed
+    }
+    
+    cursor := c.Query("cursor")
+    if cursor != "" {
+        if _, err := strconv.Atoi(cursor); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+            return
+        }
+    }
+    
+    carts, nextCursor, err := ListCarts(c.Request.Context(), limit, cursor)
+    if err != nil {
+        log.Printf("Error listing carts: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
+        })
+        return
+    }
+    
+    responses := make([]ShoppingCartResponse, 0, len(carts))
+    for i := range carts {
+        responses = append(responses, buildCartResponse(&carts[i], nil))
+    }
+    
+    c.JSON(http.StatusOK, newListEnvelope(responses, limit, nextCursor))
+}
+
+// getProductBySKU looks a product up by SKU
+// GET /products/sku/:sku
+func getProductBySKU(c *gin.Context) {
+    sku := strings.TrimSpace(c.Param("sku"))
+    if sku == "" {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":   "INVALID_INPUT",
             "message": "data input invalid",
-            "details": "invalid productId",
+            "details": "sku is required",
+        })
+        return
+    }
+
+    product, err := GetProductBySKU(c.Request.Context(), sku)
+    switch {
+    case errors.Is(err, ErrProductNotFound):
+        c.JSON(http.StatusNotFound, gin.H{
+            "error":   "NOT_FOUND",
+            "message": "product not found",
+            "details": fmt.Sprintf("no item with SKU %s", sku),
+        })
+        return
+    case errors.Is(err, ErrDuplicateSKU):
+        // SKUs should be unique, report the first match but flag the conflict
+        log.Printf("Warning: %v", err)
+        c.JSON(http.StatusConflict, gin.H{
+            "error":   "CONFLICT",
+            "message": "sku matches more than one product",
+            "details": product.ToItem(),
+        })
+        return
+    case err != nil:
+        log.Printf("Error getting product by SKU: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error":   "INTERNAL_SERVER_ERROR",
+            "message": "something went wrong",
+            "details": "failed to get product",
+        })
+        return
+    }
+
+    setProductCacheHeaders(c)
+    c.JSON(http.StatusOK, product.ToItem())
+}
+
+// getCartsWithProduct lists the customers whose carts contain a product (admin only)
+// GET /products/:productId/carts?limit={n}&cursor={customer_id}
+func getCartsWithProduct(c *gin.Context) {
+    productID, ok := parseIntParam(c, "productId")
+    if !ok {
+        return
+    }
+
+    limit := 25
+    if limitParam := c.Query("limit"); limitParam != "" {
+        parsed, err := strconv.Atoi(limitParam)
+        if err != nil || parsed < 1 || parsed > 100 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+            return
+        }
+        limit = parsed
+    }
+
+    cursor := c.Query("cursor")
+    if cursor != "" {
+        if _, err := strconv.Atoi(cursor); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+            return
+        }
+    }
+
+    customerIDs, nextCursor, err := FindCartsWithProduct(c.Request.Context(), productID, limit, cursor)
+    if err != nil {
+        log.Printf("Error finding carts with product %d: %v", productID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
+        })
+        return
+    }
+
+    c.JSON(http.StatusOK, newListEnvelope(customerIDs, limit, nextCursor))
+}
+
+// getShoppingCartsBatch retrieves many carts at once for analytics (admin only)
+// POST /shopping-carts/batch with {"customer_ids": [...]}
+func getShoppingCartsBatch(c *gin.Context) {
+    var input struct {
+        CustomerIDs []int `json:"customer_ids" binding:"required,min=1"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        writeCartBindError(c, err, "customer_ids must be a non-empty array")
+        return
+    }
+    if len(input.CustomerIDs) > maxBatchCarts {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": fmt.Sprintf("at most %d customer_ids are allowed per request", maxBatchCarts),
+        })
+        return
+    }
+    
+    carts, err := GetCarts(c.Request.Context(), input.CustomerIDs)
+    if err != nil {
+        log.Printf("Error retrieving carts: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
         })
         return
     }
+    
+    // One entry per requested ID, in request order
+    type batchCartResult struct {
+        CustomerID int                   `json:"customer_id"`
+        Found      bool                  `json:"found"`
+        Cart       *ShoppingCartResponse `json:"cart,omitempty"`
+    }
+    results := make([]batchCartResult, 0, len(input.CustomerIDs))
+    for _, customerID := range input.CustomerIDs {
+        result := batchCartResult{CustomerID: customerID}
+        if cart, ok := carts[customerID]; ok {
+            response := buildCartResponse(cart, nil)
+            result.Found = true
+            result.Cart = &response
+        }
+        results = append(results, result)
+    }
+    
+    c.JSON(http.StatusOK, gin.H{
+        "carts": results,
+        "found": len(carts),
+    })
+}
+
+// getCartItem retrieves a single line item from a customer's cart
+// GET /shopping-carts/:id/items/:productId (where id is customer_id)
+func getCartItem(c *gin.Context) {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
+        return
+    }
+    
+    productID, ok := parseIntParam(c, "productId")
+    if !ok {
+        return
+    }
+    
+    cart, err := store.GetCart(c.Request.Context(), customerID)
+    if errors.Is(err, ErrCartNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{
+            "error": "Cart not found",
+        })
+        return
+    }
+    if err != nil {
+        log.Printf("Error retrieving cart: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
+        })
+        return
+    }
+    
+    for _, item := range cart.Items {
+        if item.ID != productID {
+            continue
+        }
+        
+        line := CartItemResponse{
+            ID:           cartLineID(cart, item.ID),
+            ProductID:    item.ID,
+            Manufacturer: item.Manufacturer,
+            Category:     item.Category,
+            Quantity:     item.Quantity,
+            CreatedAt:    cart.CreatedAt,
+            UpdatedAt:    cart.UpdatedAt,
+        }
+        // Enrich with current product details, the line item is still valid without them
+        if product, err := store.GetProductAllowStale(c.Request.Context(), productID); err == nil {
+            details := product.ToItem()
+            line.Product = &details
+        }
+        
+        c.JSON(http.StatusOK, line)
+        return
+    }
+    
+    c.JSON(http.StatusNotFound, gin.H{
+        "error": "Item not found in cart",
+    })
+}
+
+// cartLineID returns the synthetic line ID buildCartResponse assigns to a
+// product: its 1-based position in product_id order
+func cartLineID(cart *CartItem, productID int) int {
+    id := 1
+    for _, item := range cart.Items {
+        if item.ID < productID {
+            id++
+        }
+    }
+    return id
+}
+
+// moveCartItem moves an item and its quantity from one customer's cart to another's
+// POST /shopping-carts/:id/items/:productId/move (where id is the source customer_id)
+func moveCartItem(c *gin.Context) {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
+        return
+    }
+    
+    productID, ok := parseIntParam(c, "productId")
+    if !ok {
+        return
+    }
+    
+    var input struct {
+        CustomerID int `json:"customer_id" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        writeCartBindError(c, err, "target customer_id is required")
+        return
+    }
+    if input.CustomerID == customerID {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": "target cart must be different from the source cart",
+        })
+        return
+    }
+    
+    source, target, err := MoveCartItem(c.Request.Context(), customerID, input.CustomerID, productID)
+    if err != nil {
+        switch {
+        case errors.Is(err, ErrCartNotFound), errors.Is(err, ErrItemNotInCart):
+            c.JSON(http.StatusNotFound, gin.H{
+                "error": err.Error(),
+            })
+        case errors.Is(err, ErrCartFull), errors.Is(err, ErrQuantityTooLarge), errors.Is(err, ErrCartTooLarge), errors.Is(err, ErrCartConflict):
+            c.JSON(http.StatusConflict, gin.H{
+                "error": err.Error(),
+            })
+        default:
+            log.Printf("Error moving cart item: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{
+                "error": "Failed to move item",
+            })
+        }
+        return
+    }
+    
+    c.JSON(http.StatusOK, gin.H{
+        "message": fmt.Sprintf("product %d moved from customer %d to customer %d", productID, customerID, input.CustomerID),
+        "source":  buildCartResponse(source, nil),
+        "target":  buildCartResponse(target, nil),
+    })
+}
+
+// transferShoppingCart moves a cart to another customer ID. If the target
+// already has a cart the request fails with 409 unless merge is true.
+// POST /shopping-carts/:id/transfer
+func transferShoppingCart(c *gin.Context) {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
+        return
+    }
+
+    var input struct {
+        CustomerID int  `json:"customer_id" binding:"required"`
+        Merge      bool `json:"merge"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        writeCartBindError(c, err, "target customer_id is required")
+        return
+    }
+    if input.CustomerID == customerID {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": "target customer must be different from the source customer",
+        })
+        return
+    }
+
+    cart, err := TransferCart(c.Request.Context(), customerID, input.CustomerID, input.Merge)
+    if err != nil {
+        switch {
+        case errors.Is(err, ErrCartNotFound):
+            c.JSON(http.StatusNotFound, gin.H{
+                "error": err.Error(),
+            })
+        case errors.Is(err, ErrCartExists), errors.Is(err, ErrCartFull), errors.Is(err, ErrQuantityTooLarge),
+            errors.Is(err, ErrCartTooLarge), errors.Is(err, ErrCartConflict):
+            c.JSON(http.StatusConflict, gin.H{
+                "error": err.Error(),
+            })
+        default:
+            log.Printf("Error transferring cart: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{
+                "error": "Failed to transfer cart",
+            })
+        }
+        return
+    }
+
+    c.Header("Location", fmt.Sprintf("/shopping-carts/%d", input.CustomerID))
+    c.JSON(http.StatusOK, buildCartResponse(cart, nil))
+}
+
+// addItemToCart adds or updates an item in the shopping cart by customer ID
+// POST /shopping-carts/:id/items (where id is customer_id)
+func addItemToCart(c *gin.Context) {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
+        return
+    }
+    
+    // Parse request body. mode "add" (default) increments an existing line's
+    // quantity, mode "set" replaces it.
+    var input struct {
+        ProductID int    `json:"product_id" binding:"required"`
+        Quantity  *int   `json:"quantity" binding:"omitempty,min=1"` // defaults to defaultCartQuantity
+        Mode      string `json:"mode" binding:"omitempty,oneof=add set"`
+    }
+    
+    if err := c.ShouldBindJSON(&input); err != nil {
+        writeCartBindError(c, err, "product_id is required, quantity must be at least 1, mode must be add or set")
+        return
+    }
+
+    // Quick-add buttons may omit the quantity
+    quantity := defaultCartQuantity
+    if input.Quantity != nil {
+        quantity = *input.Quantity
+    }
+    
+    // Verify product exists in DynamoDB
+    product, err := store.GetProduct(c.Request.Context(), input.ProductID)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": "Product not found",
+        })
+        return
+    }
+    
+    // With write-behind enabled, adds are queued and applied on the next flush
+    if cartBuffer != nil && input.Mode != "set" {
+        cartBuffer.Add(customerID, input.ProductID, quantity)
+        c.JSON(http.StatusAccepted, gin.H{
+            "message":    "Item add queued",
+            "product_id": input.ProductID,
+            "quantity":   quantity,
+        })
+        return
+    }
+
+    // Add item to cart (or set its quantity) using DynamoDB function
+    var action CartAction
+    var newQuantity int
+    if input.Mode == "set" {
+        action, newQuantity, err = store.SetCartItemQuantity(c.Request.Context(), customerID, input.ProductID, quantity)
+    } else {
+        action, newQuantity, err = store.AddToCart(c.Request.Context(), customerID, input.ProductID, quantity)
+    }
+    if errors.Is(err, ErrCartFull) || errors.Is(err, ErrQuantityTooLarge) || errors.Is(err, ErrCartTooLarge) ||
+        errors.Is(err, ErrInsufficientStock) || errors.Is(err, ErrCartConflict) {
+        c.JSON(http.StatusConflict, gin.H{
+            "error": err.Error(),
+        })
+        return
+    }
+    if err != nil {
+        log.Printf("Error adding item to cart: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Failed to add item to cart",
+        })
+        return
+    }
+
+    message := "Item added to cart successfully"
+    switch action {
+    case CartActionIncremented:
+        message = fmt.Sprintf("Item quantity increased by %d", quantity)
+    case CartActionSet:
+        message = fmt.Sprintf("Item quantity set to %d", quantity)
+    }
+    
+    // Get updated cart to return
+    cart, err := store.GetCart(c.Request.Context(), customerID)
+    if err != nil {
+        log.Printf("Error retrieving updated cart: %v", err)
+        c.JSON(http.StatusOK, gin.H{
+            "message":      message,
+            "action":       action,
+            "product_id":   input.ProductID,
+            "quantity":     quantity,
+            "new_quantity": newQuantity,
+        })
+        return
+    }
+    
+    // Find the added/updated item in the cart
+    var addedItem CartItemResponse
+    for _, item := range cart.Items {
+        if item.ID == input.ProductID {
+            addedItem = CartItemResponse{
+                ID:           cartLineID(cart, item.ID),
+                ProductID:    item.ID,
+                Manufacturer: product.Manufacturer,
+                Category:     product.Category,
+                Quantity:     item.Quantity,
+                CreatedAt:    cart.CreatedAt,
+                UpdatedAt:    cart.UpdatedAt,
+            }
+            break
+        }
+    }
+    
+    // new_quantity comes from the write itself, so it's right even when the
+    // read above is eventually consistent and misses the change
+    c.JSON(http.StatusOK, gin.H{
+        "message":      message,
+        "action":       action,
+        "item":         addedItem,
+        "new_quantity": newQuantity,
+    })
+}
+
+// writeWishlistError maps wishlist errors to HTTP responses
+func writeWishlistError(c *gin.Context, err error) {
+    switch {
+    case errors.Is(err, ErrWishlistsDisabled):
+        c.JSON(http.StatusServiceUnavailable, gin.H{
+            "error": err.Error(),
+        })
+    case errors.Is(err, ErrWishlistNotFound), errors.Is(err, ErrCartNotFound), errors.Is(err, ErrItemNotInCart):
+        c.JSON(http.StatusNotFound, gin.H{
+            "error": err.Error(),
+        })
+    case errors.Is(err, ErrCartFull), errors.Is(err, ErrQuantityTooLarge), errors.Is(err, ErrCartTooLarge), errors.Is(err, ErrCartConflict):
+        c.JSON(http.StatusConflict, gin.H{
+            "error": err.Error(),
+        })
+    default:
+        log.Printf("Error updating wishlist: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
+        })
+    }
+}
+
+// getWishlist retrieves a customer's wishlist
+// GET /wishlists/:id (where id is customer_id)
+func getWishlist(c *gin.Context) {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
+        return
+    }
+    
+    wishlist, err := GetWishlist(c.Request.Context(), customerID)
+    if err != nil {
+        writeWishlistError(c, err)
+        return
+    }
+    
+    c.JSON(http.StatusOK, buildCartResponse(wishlist, nil))
+}
+
+// addItemToWishlist adds a product to a customer's wishlist, creating it if needed
+// POST /wishlists/:id/items (where id is customer_id)
+func addItemToWishlist(c *gin.Context) {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
+        return
+    }
+    
+    // Quantity is optional for wishlists and defaults to 1
+    var input struct {
+        ProductID int `json:"product_id" binding:"required"`
+        Quantity  int `json:"quantity" binding:"omitempty,min=1"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        writeCartBindError(c, err, "product_id is required and quantity must be at least 1")
+        return
+    }
+    if input.Quantity == 0 {
+        input.Quantity = 1
+    }
+    
+    if _, err := store.GetProduct(c.Request.Context(), input.ProductID); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error": "Product not found",
+        })
+        return
+    }
+    
+    wishlist, err := AddToWishlist(c.Request.Context(), customerID, input.ProductID, input.Quantity)
+    if err != nil {
+        writeWishlistError(c, err)
+        return
+    }
+    
+    c.JSON(http.StatusOK, buildCartResponse(wishlist, nil))
+}
+
+// removeItemFromWishlist removes a product from a customer's wishlist
+// DELETE /wishlists/:id/items/:productId (where id is customer_id)
+func removeItemFromWishlist(c *gin.Context) {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
+        return
+    }
+    
+    productID, ok := parseIntParam(c, "productId")
+    if !ok {
+        return
+    }
+    
+    wishlist, err := RemoveFromWishlist(c.Request.Context(), customerID, productID)
+    if err != nil {
+        writeWishlistError(c, err)
+        return
+    }
+    
+    c.JSON(http.StatusOK, buildCartResponse(wishlist, nil))
+}
+
+// moveWishlistItemToCart moves a product from a customer's wishlist to their cart
+// POST /wishlists/:id/items/:productId/move-to-cart (where id is customer_id)
+func moveWishlistItemToCart(c *gin.Context) {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
+        return
+    }
+    
+    productID, ok := parseIntParam(c, "productId")
+    if !ok {
+        return
+    }
+    
+    wishlist, cart, err := MoveWishlistItemToCart(c.Request.Context(), customerID, productID)
+    if err != nil {
+        writeWishlistError(c, err)
+        return
+    }
+    
+    c.JSON(http.StatusOK, gin.H{
+        "message":  fmt.Sprintf("product %d moved from wishlist to cart", productID),
+        "wishlist": buildCartResponse(wishlist, nil),
+        "cart":     buildCartResponse(cart, nil),
+    })
+}
+
+// CustomerExport is everything stored about a customer. There is no
+// customer or order store in this service, so it holds the cart and wishlist.
+type CustomerExport struct {
+    CustomerID int                   `json:"customer_id"`
+    ExportedAt string                `json:"exported_at"`
+    Cart       *ShoppingCartResponse `json:"cart"`     // null when the customer has no cart
+    Wishlist   *ShoppingCartResponse `json:"wishlist"` // null when there is none or wishlists are disabled
+}
+
+// exportCustomerData returns all of a customer's data as a downloadable JSON
+// document (admin only: the API token isn't tied to a customer, so there's no
+// way to check the caller is the one being exported)
+// GET /customers/:id/export
+func exportCustomerData(c *gin.Context) {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
+        return
+    }
+
+    export := CustomerExport{
+        CustomerID: customerID,
+        ExportedAt: nowRFC3339(),
+    }
+
+    cart, err := store.GetCart(c.Request.Context(), customerID)
+    switch {
+    case err == nil:
+        response := buildCartResponse(cart, nil)
+        export.Cart = &response
+    case !errors.Is(err, ErrCartNotFound):
+        log.Printf("Error exporting cart: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
+        })
+        return
+    }
+
+    wishlist, err := GetWishlist(c.Request.Context(), customerID)
+    switch {
+    case err == nil:
+        response := buildCartResponse(wishlist, nil)
+        export.Wishlist = &response
+    case !errors.Is(err, ErrWishlistNotFound) && !errors.Is(err, ErrWishlistsDisabled):
+        log.Printf("Error exporting wishlist: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
+        })
+        return
+    }
+
+    // Customers only exist through their cart or wishlist
+    if export.Cart == nil && export.Wishlist == nil {
+        c.JSON(http.StatusNotFound, gin.H{
+            "error": "Customer not found",
+        })
+        return
+    }
+
+    c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="customer-%d-export.json"`, customerID))
+    c.JSON(http.StatusOK, export)
+}
+
+// deleteCustomerData erases a customer's cart and wishlist (admin only)
+// DELETE /customers/:id/data
+func deleteCustomerData(c *gin.Context) {
+    customerID, ok := parseIntParam(c, "id")
+    if !ok {
+        return
+    }
+
+    summary, err := DeleteCustomerData(c.Request.Context(), customerID)
+    if errors.Is(err, ErrCartConflict) {
+        c.JSON(http.StatusConflict, gin.H{
+            "error": "Cart changed during erasure, retry",
+        })
+        return
+    }
+    if err != nil {
+        log.Printf("Error erasing data of customer %d: %v", customerID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error": "Internal server error",
+        })
+        return
+    }
+
+    // Audit trail of erasures
+    log.Printf("AUDIT: erased data of customer %d from %s (cart deleted: %t, wishlist deleted: %t, reservations released: %d)",
+        customerID, c.ClientIP(), summary.CartDeleted, summary.WishlistDeleted, summary.ReservationsReleased)
+
+    c.JSON(http.StatusOK, summary)
+}
+
+// Sources of /products/search: the in-memory catalog, or DynamoDB reads of a
+// random sample of product IDs (for comparing read latency)
+const (
+    searchSourceMemory = "memory"
+    searchSourceDynamo = "dynamo"
+)
+
+// Search count modes (count_mode). exact searches the whole catalog so
+// total_found and facets cover every match. page searches in ID order from
+// the cursor and stops as soon as the page is full and one more match shows
+// there is a next page, so total_found and facets are lower bounds covering
+// only the products examined. source=dynamo always counts its whole sample
+// and reports exact.
+const (
+    countModeExact = "exact"
+    countModePage  = "page"
+)
+
+// maxSearchSample caps the IDs read per search with source=dynamo
+const maxSearchSample = 1000
+
+// searchMaxScan caps the products a single search examines, 0 for no cap
+// (SEARCH_MAX_SCAN). A capped in-memory search scans the searchMaxScan lowest
+// IDs after the cursor and, if that wasn't the whole rest of the catalog,
+// returns the last scanned ID as next_cursor so the next page resumes the
+// scan there. Pages may then hold fewer than limit products (even none)
+// while next_cursor is set, and total_found and facets only cover the
+// products scanned for this page. With source=dynamo the cap lowers sample.
+var searchMaxScan int
+
+// searchProducts matches q against product names, categories and brands.
+// By default the whole in-memory catalog is searched. With source=dynamo a
+// random sample of IDs is read from DynamoDB in batches instead and only
+// those products are searched, to benchmark DynamoDB reads through this
+// endpoint. Every request draws a new sample, so such results have no pages:
+// cursor is rejected and next_cursor is always empty.
+// GET /products/search?q={query}&limit={n}&cursor={id}&source={memory|dynamo}&sample={n}&count_mode={page|exact}
+func searchProducts(c *gin.Context) {
+    defer func() {
+        if r := recover(); r != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{
+                "error":   "INTERNAL_SERVER_ERROR",
+                "message": "something went wrong",
+                "details": fmt.Sprintf("%v", r),
+            })
+        }
+    }()
+    startTime := time.Now()
+
+    // Extract query parameter
+    query := c.Query("q")
+    if query == "" {
+        c.JSON(400, gin.H{"error": "Query parameter 'q' is required"})
+        return
+    }
+    // Convert query to lowercase for case-insensitive search
+    queryLower := strings.ToLower(query)
+
+    // Maximum number of products returned, all matches are still counted
+    limit := 20
+    if limitParam := c.Query("limit"); limitParam != "" {
+        parsed, err := strconv.Atoi(limitParam)
+        if err != nil || parsed < 1 || parsed > 100 {
+            c.JSON(400, gin.H{"error": "limit must be between 1 and 100"})
+            return
+        }
+        limit = parsed
+    }
+
+    // The cursor is the last product ID of the previous page
+    cursor := 0
+    if cursorParam := c.Query("cursor"); cursorParam != "" {
+        parsed, err := strconv.Atoi(cursorParam)
+        if err != nil || parsed < 0 {
+            c.JSON(400, gin.H{"error": "invalid cursor"})
+            return
+        }
+        cursor = parsed
+    }
+
+    source := c.DefaultQuery("source", searchSourceMemory)
+    if source != searchSourceMemory && source != searchSourceDynamo {
+        c.JSON(400, gin.H{"error": "source must be memory or dynamo"})
+        return
+    }
+    highlight := false
+    if highlightParam := c.Query("highlight"); highlightParam != "" {
+        parsed, err := strconv.ParseBool(highlightParam)
+        if err != nil {
+            c.JSON(400, gin.H{"error": "highlight must be true or false"})
+            return
+        }
+        highlight = parsed
+    }
+    sample := 100
+    if sampleParam := c.Query("sample"); sampleParam != "" {
+        parsed, err := strconv.Atoi(sampleParam)
+        if err != nil || parsed < 1 || parsed > maxSearchSample {
+            c.JSON(400, gin.H{"error": fmt.Sprintf("sample must be between 1 and %d", maxSearchSample)})
+            return
+        }
+        sample = parsed
+    }
+    countMode := c.DefaultQuery("count_mode", countModePage)
+    if countMode != countModePage && countMode != countModeExact {
+        c.JSON(400, gin.H{"error": "count_mode must be page or exact"})
+        return
+    }
+    if source == searchSourceDynamo {
+        countMode = countModeExact
+        if cursor > 0 {
+            c.JSON(400, gin.H{"error": "cursor is not supported with source=dynamo, every request searches a new sample"})
+            return
+        }
+    }
+    scanLimited := false
+    if source == searchSourceDynamo && searchMaxScan > 0 && sample > searchMaxScan {
+        sample = searchMaxScan
+        scanLimited = true
+    }
+
+    // Keep the `limit` matches with the lowest IDs after the cursor
+    var matchingProducts []Item
+    totalFound := 0
+    totalSearched := 0 // incremented once per product examined
+    lastScanned := 0 // last ID examined by a capped in-memory scan
+    remaining := 0 // matches after the cursor
+    facets := SearchFacets{
+        Categories: map[string]int{},
+        Brands:     map[string]int{},
+    }
+
+    consider := func(item Item) {
+        totalSearched++
+
+        // Check if query matches name, category, or brand (case-insensitive)
+        if !strings.Contains(strings.ToLower(item.Name), queryLower) &&
+            !strings.Contains(strings.ToLower(item.Category), queryLower) &&
+            !strings.Contains(strings.ToLower(item.Brand), queryLower) {
+            return
+        }
+
+        totalFound++
+        facets.Categories[item.Category]++
+        facets.Brands[item.Brand]++
+        if item.ID <= cursor {
+            return
+        }
+        remaining++
+
+        matchingProducts = insertLowestIDs(matchingProducts, item, limit)
+    }
+
+    if source == searchSourceDynamo {
+        products, err := store.GetProductsAllowStale(c.Request.Context(), sampleProductIDs(sample))
+        if err != nil {
+            log.Printf("Error reading sampled products: %v", err)
+            c.JSON(http.StatusServiceUnavailable, gin.H{
+                "error":   "SERVICE_UNAVAILABLE",
+                "message": "Failed to read products",
+                "details": "the product store is unavailable, try again later",
+            })
+            return
+        }
+        for _, product := range products {
+            consider(product.ToItem())
+        }
+    } else if searchMaxScan > 0 || countMode == countModePage {
+        // Scan in ID order from the cursor so capped pages resume where the
+        // previous one stopped, and page counting can stop early
+        ids := productIDs.after(cursor)
+        if searchMaxScan > 0 && len(ids) > searchMaxScan {
+            ids = ids[:searchMaxScan]
+            scanLimited = true
+            lastScanned = ids[len(ids)-1]
+        }
+        for _, id := range ids {
+            if countMode == countModePage && remaining > limit {
+                break // the page is full and there is a next one
+            }
+            if value, ok := syncProducts.Load(id); ok {
+                consider(value.(Item))
+            }
+        }
+    } else {
+        syncProducts.Range(func(_, value any) bool {
+            consider(value.(Item))
+            return true
+        })
+    }
+
+    // Calculate search duration
+    duration := time.Since(startTime)
+    searchTime := fmt.Sprintf("%.3fs", duration.Seconds())
+
+    // More matches past this page means there is a next page, except in a
+    // DynamoDB sample, which the next request wouldn't draw again
+    nextCursor := ""
+    if remaining > len(matchingProducts) && source != searchSourceDynamo {
+        nextCursor = strconv.Itoa(matchingProducts[len(matchingProducts)-1].ID)
+    } else if lastScanned > 0 {
+        // Every match of this page is in, resume scanning after the cap
+        nextCursor = strconv.Itoa(lastScanned)
+    }
+
+    // Items are copies, so highlighting doesn't touch the catalog
+    if highlight {
+        for i := range matchingProducts {
+            item := &matchingProducts[i]
+            item.Name = highlightMatches(item.Name, queryLower)
+            item.Brand = highlightMatches(item.Brand, queryLower)
+            item.Category = highlightMatches(item.Category, queryLower)
+        }
+    }
+
+    // Create response
+    response := SearchResponse{
+        ListEnvelope:  newListEnvelope(matchingProducts, limit, nextCursor),
+        TotalFound:    totalFound,
+        TotalSearched: totalSearched,
+        SearchTime:    searchTime,
+        Source:        source,
+        ScanLimited:   scanLimited,
+        CountMode:     countMode,
+        Facets:        facets,
+    }
+
+    if source == searchSourceDynamo {
+        // Each request measures fresh DynamoDB reads of a new random sample,
+        // a cached response would measure nothing
+        c.Header("Cache-Control", "no-store")
+    } else {
+        setProductCacheHeaders(c)
+    }
+    c.JSON(200, response)
+}
+
+// Delimiters wrapped around search matches with highlight=true
+// (SEARCH_HIGHLIGHT_PRE, SEARCH_HIGHLIGHT_POST)
+var (
+    highlightPre  = "<em>"
+    highlightPost = "</em>"
+)
+
+// highlightMatches wraps every case-insensitive occurrence of queryLower in s
+// with the highlight delimiters, keeping s's original casing. The rest of s
+// is not escaped, clients rendering it as HTML must escape it themselves.
+func highlightMatches(s, queryLower string) string {
+    // Lowercasing can change a rune's byte length, so map each byte of the
+    // lowered string back to the offset of the rune it came from
+    var lower strings.Builder
+    offsets := make([]int, 0, len(s)+1)
+    for i, r := range s {
+        lowered := strings.ToLower(string(r))
+        lower.WriteString(lowered)
+        for range len(lowered) {
+            offsets = append(offsets, i)
+        }
+    }
+    offsets = append(offsets, len(s))
+    lowerS := lower.String()
+
+    var out strings.Builder
+    last := 0 // original offset copied up to
+    for pos := 0; pos < len(lowerS); {
+        index := strings.Index(lowerS[pos:], queryLower)
+        if index < 0 {
+            break
+        }
+        start, end := pos+index, pos+index+len(queryLower)
+        // Only highlight matches that start and end on whole original runes
+        if offsets[start] >= last && (end == len(lowerS) || offsets[end] != offsets[end-1]) {
+            out.WriteString(s[last:offsets[start]])
+            out.WriteString(highlightPre)
+            out.WriteString(s[offsets[start]:offsets[end]])
+            out.WriteString(highlightPost)
+            last = offsets[end]
+            pos = end
+            continue
+        }
+        pos = start + 1
+    }
+    out.WriteString(s[last:])
+    return out.String()
+}
+
+// sampleProductIDs picks up to n distinct product IDs at random from the
+// in-memory catalog, in one pass with reservoir sampling
+func sampleProductIDs(n int) []int {
+    ids := make([]int, 0, n)
+    seen := 0
+    syncProducts.Range(func(key, _ any) bool {
+        seen++
+        if len(ids) < n {
+            ids = append(ids, key.(int))
+        } else if i := rand.Intn(seen); i < n {
+            ids[i] = key.(int)
+        }
+        return true
+    })
+    return ids
+}
+
+// insertLowestIDs adds item to page, which is sorted by ID, keeping only the
+// limit lowest IDs. sync.Map iteration order is random, so paging through
+// the in-memory catalog by ID is what makes results deterministic.
+func insertLowestIDs(page []Item, item Item, limit int) []Item {
+    // Once `limit` results are collected, only lower IDs can displace one
+    if len(page) == limit && item.ID > page[limit-1].ID {
+        return page
+    }
+    pos := sort.Search(len(page), func(i int) bool {
+        return page[i].ID > item.ID
+    })
+    page = slices.Insert(page, pos, item)
+    if len(page) > limit {
+        page = page[:limit]
+    }
+    return page
+}
+
+// listProducts pages through the in-memory catalog by ID. The optional
+// filters are combined with AND: category and brand match exactly (ignoring
+// case), minWeight and maxWeight are inclusive bounds.
+// GET /products?category={c}&brand={b}&minWeight={w}&maxWeight={w}&limit={n}&cursor={id}
+func listProducts(c *gin.Context) {
+    limit := 20
+    if limitParam := c.Query("limit"); limitParam != "" {
+        parsed, err := strconv.Atoi(limitParam)
+        if err != nil || parsed < 1 || parsed > 100 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+            return
+        }
+        limit = parsed
+    }
+
+    // The cursor is the last product ID of the previous page
+    cursor := 0
+    if cursorParam := c.Query("cursor"); cursorParam != "" {
+        parsed, err := strconv.Atoi(cursorParam)
+        if err != nil || parsed < 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+            return
+        }
+        cursor = parsed
+    }
+
+    minWeight, maxWeight := 0.0, math.Inf(1)
+    for _, bound := range []struct {
+        name  string
+        value *float64
+    }{{"minWeight", &minWeight}, {"maxWeight", &maxWeight}} {
+        param := c.Query(bound.name)
+        if param == "" {
+            continue
+        }
+        parsed, err := strconv.ParseFloat(param, 64)
+        if err != nil || parsed < 0 || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": bound.name + " must be a non-negative number"})
+            return
+        }
+        *bound.value = parsed
+    }
+    if minWeight > maxWeight {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "minWeight must not be greater than maxWeight"})
+        return
+    }
+
+    category, brand := c.Query("category"), c.Query("brand")
+
+    var page []Item
+    remaining := 0 // matches after the cursor
+    syncProducts.Range(func(_, value any) bool {
+        item := value.(Item)
+        if item.ID <= cursor ||
+            item.Weight < minWeight || item.Weight > maxWeight ||
+            (category != "" && !strings.EqualFold(item.Category, category)) ||
+            (brand != "" && !strings.EqualFold(item.Brand, brand)) {
+            return true
+        }
+        remaining++
+        page = insertLowestIDs(page, item, limit)
+        return true
+    })
+
+    // More matches past this page means there is a next page
+    nextCursor := ""
+    if remaining > len(page) {
+        nextCursor = strconv.Itoa(page[len(page)-1].ID)
+    }
+
+    setProductCacheHeaders(c)
+    c.JSON(http.StatusOK, newListEnvelope(page, limit, nextCursor))
+}
+
+// getProductsByName returns the products whose name equals name, ignoring
+// case, lowest IDs first. Names aren't unique, so this is a list, empty when
+// nothing matches. It is an in-memory lookup like listProducts.
+// GET /products/by-name?name={name}&limit={n}&cursor={id}
+func getProductsByName(c *gin.Context) {
+    name := c.Query("name")
+    if name == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'name' is required"})
+        return
+    }
+
+    limit := 20
+    if limitParam := c.Query("limit"); limitParam != "" {
+        parsed, err := strconv.Atoi(limitParam)
+        if err != nil || parsed < 1 || parsed > 100 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+            return
+        }
+        limit = parsed
+    }
+
+    // The cursor is the last product ID of the previous page
+    cursor := 0
+    if cursorParam := c.Query("cursor"); cursorParam != "" {
+        parsed, err := strconv.Atoi(cursorParam)
+        if err != nil || parsed < 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+            return
+        }
+        cursor = parsed
+    }
+
+    var page []Item
+    remaining := 0 // matches after the cursor
+    syncProducts.Range(func(_, value any) bool {
+        item := value.(Item)
+        if item.ID <= cursor || !strings.EqualFold(item.Name, name) {
+            return true
+        }
+        remaining++
+        page = insertLowestIDs(page, item, limit)
+        return true
+    })
+
+    nextCursor := ""
+    if remaining > len(page) {
+        nextCursor = strconv.Itoa(page[len(page)-1].ID)
+    }
+
+    setProductCacheHeaders(c)
+    c.JSON(http.StatusOK, newListEnvelope(page, limit, nextCursor))
+}
+
+// getPopularProducts returns the most added-to-cart products, most popular
+// first. The ranking is refreshed in the background, so it may lag recent adds.
+// GET /products/popular?limit={n}
+func getPopularProducts(c *gin.Context) {
+    limit := 10
+    if limitParam := c.Query("limit"); limitParam != "" {
+        parsed, err := strconv.Atoi(limitParam)
+        if err != nil || parsed < 1 || parsed > 100 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+            return
+        }
+        limit = parsed
+    }
+
+    var ranking []ProductPopularity
+    if latest := popularityRanking.Load(); latest != nil {
+        ranking = *latest
+    }
+
+    popular := make([]PopularProduct, 0, limit)
+    for _, entry := range ranking {
+        if len(popular) == limit {
+            break
+        }
+        value, ok := syncProducts.Load(entry.ProductID)
+        if !ok {
+            continue
+        }
+        popular = append(popular, PopularProduct{Item: value.(Item), Popularity: entry.Popularity})
+    }
+
+    setProductCacheHeaders(c)
+    c.JSON(http.StatusOK, newListEnvelope(popular, limit, ""))
+}
+
+// getProductCategories returns the sorted distinct product categories for
+// navigation menus. The list comes from a background scan of the products
+// table (FACETS_REFRESH_SECONDS), so it is eventually consistent: a
+// category written through this instance appears immediately, but one added
+// through another instance, or one whose last product changed category, only
+// shows up or disappears after the next scan.
+// GET /products/categories
+func getProductCategories(c *gin.Context) {
+    categories := productCategories.Load()
+    if categories == nil {
+        c.Header("Retry-After", "5")
+        c.JSON(http.StatusServiceUnavailable, gin.H{
+            "error":   "SERVICE_UNAVAILABLE",
+            "message": "categories are still loading",
+            "details": "retry shortly",
+        })
+        return
+    }
+
+    setProductCacheHeaders(c)
+    c.JSON(http.StatusOK, gin.H{
+        "categories": *categories,
+    })
+}
+
+// getProductBrands returns every brand with its product count, most products
+// first, for a brand filter. Counts come from the same background scan as
+// getProductCategories and are only updated by it, so they may lag product
+// writes by up to FACETS_REFRESH_SECONDS.
+// GET /products/brands
+func getProductBrands(c *gin.Context) {
+    brands := productBrands.Load()
+    if brands == nil {
+        c.Header("Retry-After", "5")
+        c.JSON(http.StatusServiceUnavailable, gin.H{
+            "error":   "SERVICE_UNAVAILABLE",
+            "message": "brands are still loading",
+            "details": "retry shortly",
+        })
+        return
+    }
+
+    setProductCacheHeaders(c)
+    c.JSON(http.StatusOK, gin.H{
+        "brands": *brands,
+    })
+}
+
+// suggestProducts returns up to 10 distinct product names or brands starting
+// with the query, for search-box autocomplete. Only strings are returned to
+// keep the response small.
+// GET /products/suggest?q={query}
+func suggestProducts(c *gin.Context) {
+    query := strings.ToLower(strings.TrimSpace(c.Query("q")))
+    if query == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter 'q' is required"})
+        return
+    }
+
+    // Collect distinct matches from the in-memory catalog
+    seen := make(map[string]bool)
+    var suggestions []string
+    syncProducts.Range(func(_, value any) bool {
+        item := value.(Item)
+        for _, candidate := range []string{item.Brand, item.Name} {
+            if !seen[candidate] && strings.HasPrefix(strings.ToLower(candidate), query) {
+                seen[candidate] = true
+                suggestions = append(suggestions, candidate)
+            }
+        }
+        return true
+    })
+
+    // Most relevant first: shortest (closest to the query) then alphabetical
+    sort.Slice(suggestions, func(i, j int) bool {
+        if len(suggestions[i]) != len(suggestions[j]) {
+            return len(suggestions[i]) < len(suggestions[j])
+        }
+        return suggestions[i] < suggestions[j]
+    })
+    if len(suggestions) > 10 {
+        suggestions = suggestions[:10]
+    }
+    if suggestions == nil {
+        suggestions = []string{}
+    }
+
+    setProductCacheHeaders(c)
+    c.JSON(http.StatusOK, gin.H{
+        "query":       query,
+        "suggestions": suggestions,
+    })
+}
+
+// ProductMismatch describes a product whose DynamoDB and in-memory copies differ
+type ProductMismatch struct {
+    ProductID int      `json:"product_id"`
+    Fields    []string `json:"fields,omitempty"`
+    Reason    string   `json:"reason"`
+}
+
+// getRawItem returns a stored item as raw DynamoDB JSON, for debugging
+// fields that UnmarshalMap drops or misreads (admin only)
+// GET /admin/raw/:table/:key, table is products, carts, wishlists or promos
+func getRawItem(c *gin.Context) {
+    item, err := GetRawItem(c.Request.Context(), c.Param("table"), c.Param("key"))
+    switch {
+    case errors.Is(err, ErrUnknownTable), errors.Is(err, ErrInvalidKey):
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    case errors.Is(err, ErrItemNotFound):
+        c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+        return
+    case err != nil:
+        log.Printf("Error reading raw item: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "table": c.Param("table"),
+        "key":   c.Param("key"),
+        "item":  item,
+    })
+}
+
+// Endpoint is one route listed by the root descriptor
+type Endpoint struct {
+    Method string `json:"method"`
+    Path   string `json:"path"`
+}
+
+// serviceDescriptor describes the service and lists every registered route,
+// read from the router at request time so the list can't go stale
+// GET /
+func serviceDescriptor(router *gin.Engine) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        routes := router.Routes()
+        endpoints := make([]Endpoint, 0, len(routes))
+        for _, route := range routes {
+            endpoints = append(endpoints, Endpoint{Method: route.Method, Path: route.Path})
+        }
+        sort.Slice(endpoints, func(i, j int) bool {
+            if endpoints[i].Path != endpoints[j].Path {
+                return endpoints[i].Path < endpoints[j].Path
+            }
+            return endpoints[i].Method < endpoints[j].Method
+        })
+
+        c.JSON(http.StatusOK, gin.H{
+            "name":      serviceName,
+            "version":   version,
+            "endpoints": endpoints,
+        })
+    }
+}
+
+// healthLatencyThreshold is the DynamoDB round trip above which
+// /health/detail reports degraded (HEALTH_LATENCY_THRESHOLD_MS)
+var healthLatencyThreshold = 200 * time.Millisecond
+
+// getHealthDetail reports the DynamoDB round-trip latency: healthy, degraded
+// when it exceeds healthLatencyThreshold (still 200, so load balancers keep
+// routing) or unhealthy with 503 when DynamoDB can't be reached
+// GET /health/detail
+func getHealthDetail(c *gin.Context) {
+    ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+    defer cancel()
+
+    latency, err := PingDynamoDB(ctx)
+    latencyMs := float64(latency) / float64(time.Millisecond)
+    response := gin.H{
+        "status":                      "healthy",
+        "database":                    "dynamodb",
+        "dynamo_latency_ms":           latencyMs,
+        "dynamo_latency_threshold_ms": healthLatencyThreshold.Milliseconds(),
+        "seeding_complete":            seedingComplete.Load(),
+    }
+    if err != nil {
+        log.Printf("Health check failed: %v", err)
+        response["status"] = "unhealthy"
+        response["error"] = err.Error()
+        c.JSON(http.StatusServiceUnavailable, response)
+        return
+    }
+    if latency > healthLatencyThreshold {
+        response["status"] = "degraded"
+    }
+    c.JSON(http.StatusOK, response)
+}
+
+// AbandonedProduct is one entry of /admin/abandoned-products
+type AbandonedProduct struct {
+    ProductID int    `json:"product_id"`
+    Name      string `json:"name,omitempty"`
+    CartProductStats
+    // AbandonmentRate is AbandonedCarts over all carts holding the product
+    AbandonmentRate float64 `json:"abandonment_rate"`
+    Adds            int64   `json:"adds"` // lifetime add-to-cart count, see IncrementPopularity
+}
+
+// getAbandonedProducts ranks products by how often the carts holding them
+// were abandoned, highest rate first (admin only). The service has no orders,
+// so an expired cart still awaiting TTL deletion stands in for a cart that
+// was never checked out. Cost: every request scans the whole carts table,
+// about one read unit per 8 KB of stored carts (the projection trims the
+// response, not the read cost), so each page comes from its own scan and
+// rankings may shift between requests; the cursor is the rank offset of the
+// next page.
+// GET /admin/abandoned-products?limit={n}&cursor={offset}&min_carts={n}
+func getAbandonedProducts(c *gin.Context) {
+    limit := 25
+    if limitParam := c.Query("limit"); limitParam != "" {
+        parsed, err := strconv.Atoi(limitParam)
+        if err != nil || parsed < 1 || parsed > 100 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+            return
+        }
+        limit = parsed
+    }
+    offset := 0
+    if cursorParam := c.Query("cursor"); cursorParam != "" {
+        parsed, err := strconv.Atoi(cursorParam)
+        if err != nil || parsed < 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+            return
+        }
+        offset = parsed
+    }
+    // Products in only a cart or two make for noisy rates
+    minCarts := 1
+    if minParam := c.Query("min_carts"); minParam != "" {
+        parsed, err := strconv.Atoi(minParam)
+        if err != nil || parsed < 1 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "min_carts must be a positive integer"})
+            return
+        }
+        minCarts = parsed
+    }
+
+    stats, err := ScanCartProductStats(c.Request.Context())
+    if err != nil {
+        log.Printf("Error scanning carts: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan carts"})
+        return
+    }
+
+    adds := map[int]int64{}
+    if latest := popularityRanking.Load(); latest != nil {
+        for _, entry := range *latest {
+            adds[entry.ProductID] = entry.Popularity
+        }
+    }
+
+    ranked := make([]AbandonedProduct, 0, len(stats))
+    for productID, entry := range stats {
+        total := entry.LiveCarts + entry.AbandonedCarts
+        if entry.AbandonedCarts == 0 || total < minCarts {
+            continue
+        }
+        product := AbandonedProduct{
+            ProductID:        productID,
+            CartProductStats: *entry,
+            AbandonmentRate:  float64(entry.AbandonedCarts) / float64(total),
+            Adds:             adds[productID],
+        }
+        if value, ok := syncProducts.Load(productID); ok {
+            product.Name = value.(Item).Name
+        }
+        ranked = append(ranked, product)
+    }
+    sort.Slice(ranked, func(i, j int) bool {
+        a, b := ranked[i], ranked[j]
+        if a.AbandonmentRate != b.AbandonmentRate {
+            return a.AbandonmentRate > b.AbandonmentRate
+        }
+        if a.AbandonedCarts != b.AbandonedCarts {
+            return a.AbandonedCarts > b.AbandonedCarts
+        }
+        return a.ProductID < b.ProductID
+    })
+
+    page := []AbandonedProduct{}
+    nextCursor := ""
+    if offset < len(ranked) {
+        end := min(offset+limit, len(ranked))
+        page = ranked[offset:end]
+        if end < len(ranked) {
+            nextCursor = strconv.Itoa(end)
+        }
+    }
+    c.JSON(http.StatusOK, newListEnvelope(page, limit, nextCursor))
+}
+
+// getRuntimeStats returns a snapshot of goroutine, memory and GC stats for
+// eyeballing an instance during load tests (admin only)
+// GET /admin/stats
+func getRuntimeStats(c *gin.Context) {
+    var mem runtime.MemStats
+    runtime.ReadMemStats(&mem)
+
+    // PauseNs is a circular buffer, the most recent pause is at (NumGC+255)%256
+    var lastPause time.Duration
+    if mem.NumGC > 0 {
+        lastPause = time.Duration(mem.PauseNs[(mem.NumGC+255)%256])
+    }
+
+    products := 0
+    syncProducts.Range(func(_, _ any) bool {
+        products++
+        return true
+    })
+
+    uptime := time.Since(startedAt)
+    c.JSON(http.StatusOK, gin.H{
+        "uptime":         uptime.Round(time.Second).String(),
+        "uptime_seconds": int64(uptime.Seconds()),
+        "goroutines":     runtime.NumGoroutine(),
+        "memory": gin.H{
+            "heap_alloc_bytes":  mem.HeapAlloc,
+            "heap_inuse_bytes":  mem.HeapInuse,
+            "heap_objects":      mem.HeapObjects,
+            "sys_bytes":         mem.Sys,
+            "total_alloc_bytes": mem.TotalAlloc,
+        },
+        "gc": gin.H{
+            "num_gc":         mem.NumGC,
+            "pause_total_ms": float64(mem.PauseTotalNs) / float64(time.Millisecond),
+            "last_pause_ms":  float64(lastPause) / float64(time.Millisecond),
+            "cpu_fraction":   mem.GCCPUFraction,
+        },
+        "products_in_memory": products,
+    })
+}
+
+// defaultItemsPerCart is the cart size assumed when estimating capacity
+const defaultItemsPerCart = 5
+
+// estimateCapacity estimates the DynamoDB read/write capacity a workload of
+// ops/sec per operation needs, from the item sizes and access patterns of the
+// handlers (admin only)
+// POST /admin/estimate-capacity
+func estimateCapacity(c *gin.Context) {
+    var input struct {
+        Operations   map[string]float64 `json:"operations" binding:"required,min=1"`
+        ItemsPerCart *int               `json:"items_per_cart"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        writeCartBindError(c, err, "operations must map operation names to ops/sec")
+        return
+    }
+
+    for op, rate := range input.Operations {
+        if !slices.Contains(capacityOperations, op) {
+            c.JSON(http.StatusBadRequest, gin.H{
+                "error": fmt.Sprintf("unknown operation %q, expected one of %s", op, strings.Join(capacityOperations, ", ")),
+            })
+            return
+        }
+        if rate < 0 {
+            c.JSON(http.StatusBadRequest, gin.H{
+                "error": fmt.Sprintf("ops/sec of %s must not be negative", op),
+            })
+            return
+        }
+    }
+
+    itemsPerCart := defaultItemsPerCart
+    if input.ItemsPerCart != nil {
+        if *input.ItemsPerCart < 0 || *input.ItemsPerCart > maxCartItems {
+            c.JSON(http.StatusBadRequest, gin.H{
+                "error": fmt.Sprintf("items_per_cart must be between 0 and %d", maxCartItems),
+            })
+            return
+        }
+        itemsPerCart = *input.ItemsPerCart
+    }
+
+    c.JSON(http.StatusOK, EstimateCapacity(CapacityWorkload{
+        Operations:   input.Operations,
+        ItemsPerCart: itemsPerCart,
+    }))
+}
+
+// consistencyCheck compares a sample of DynamoDB products against syncProducts
+// to detect drift in the dual-write path
+// GET /admin/consistency-check?sample={n}
+func consistencyCheck(c *gin.Context) {
+    sample := 100
+    if sampleParam := c.Query("sample"); sampleParam != "" {
+        parsed, err := strconv.Atoi(sampleParam)
+        if err != nil || parsed < 1 || parsed > 1000 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "sample must be between 1 and 1000"})
+            return
+        }
+        sample = parsed
+    }
+
+    products, err := SampleProducts(c.Request.Context(), sample)
+    if err != nil {
+        log.Printf("Error sampling products: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to scan products"})
+        return
+    }
+
+    mismatches := []ProductMismatch{}
+    for _, product := range products {
+        value, exists := syncProducts.Load(product.ID)
+        if !exists {
+            mismatches = append(mismatches, ProductMismatch{
+                ProductID: product.ID,
+                Reason:    "missing from memory",
+            })
+            continue
+        }
+        if fields := diffItems(product.ToItem(), value.(Item)); len(fields) > 0 {
+            mismatches = append(mismatches, ProductMismatch{
+                ProductID: product.ID,
+                Fields:    fields,
+                Reason:    "fields differ",
+            })
+        }
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "checked":    len(products),
+        "consistent": len(mismatches) == 0,
+        "mismatches": mismatches,
+    })
+}
+
+// diffItems returns the JSON names of the fields that differ between two items
+func diffItems(a, b Item) []string {
+    var fields []string
+    if a.SKU != b.SKU {
+        fields = append(fields, "sku")
+    }
+    if a.Manufacturer != b.Manufacturer {
+        fields = append(fields, "manufacturer")
+    }
+    if a.CategoryID != b.CategoryID {
+        fields = append(fields, "category_id")
+    }
+    if a.Weight != b.Weight {
+        fields = append(fields, "weight")
+    }
+    if a.SomeOtherID != b.SomeOtherID {
+        fields = append(fields, "some_other_id")
+    }
+    if a.Name != b.Name {
+        fields = append(fields, "name")
+    }
+    if a.Category != b.Category {
+        fields = append(fields, "category")
+    }
+    if a.Description != b.Description {
+        fields = append(fields, "description")
+    }
+    if a.Brand != b.Brand {
+        fields = append(fields, "brand")
+    }
+    if a.Stock != b.Stock {
+        fields = append(fields, "stock")
+    }
+    return fields
+}
+
+// ProductDetailsInput is the body of POST /products/:productId/details, which
+// replaces all of a product's details. Every field is required, so a partial
+// body can't blank out the fields it leaves out, and version must be the one
+// the client read. PATCH /products/:productId is the way to change only some
+// fields; there (and in bulk price updates) the version check is optional.
+type ProductDetailsInput struct {
+    ID           *int     `json:"product_id" binding:"required"`
+    SKU          *string  `json:"sku" binding:"required"`
+    Manufacturer *string  `json:"manufacturer" binding:"required"`
+    CategoryID   *int     `json:"category_id" binding:"required"`
+    Weight       *float64 `json:"weight" binding:"required"`
+    SomeOtherID  *int     `json:"some_other_id" binding:"required"`
+    Name         *string  `json:"name" binding:"required"`
+    Category     *string  `json:"category" binding:"required"`
+    Description  *string  `json:"description" binding:"required"`
+    Brand        *string  `json:"brand" binding:"required"`
+    PriceCents   *int     `json:"price_cents" binding:"required"`
+    Version      *int     `json:"version" binding:"required"`
+}
+
+// item returns the details as an Item, once binding has checked every field is set
+func (in ProductDetailsInput) item() Item {
+    return Item{
+        ID:           *in.ID,
+        SKU:          *in.SKU,
+        Manufacturer: *in.Manufacturer,
+        CategoryID:   *in.CategoryID,
+        Weight:       *in.Weight,
+        SomeOtherID:  *in.SomeOtherID,
+        Name:         *in.Name,
+        Category:     *in.Category,
+        Description:  *in.Description,
+        Brand:        *in.Brand,
+        PriceCents:   *in.PriceCents,
+        Version:      *in.Version,
+    }
+}
+
+// postAlbums adds an album from JSON received in the request body.
+func postItem(c *gin.Context) {
+
+    defer func() {
+        if r := recover(); r != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{
+                "error":   "INTERNAL_SERVER_ERROR",
+                "message": "something went wrong",
+                "details": fmt.Sprintf("%v", r),
+            })
+        }
+    }()
+
+    // Extract product ID from route
+    productID, ok := parseIntParam(c, "productId")
+    if !ok {
+        return
+    }
 
     // Check if product exists in map
     _, exists := syncProducts.Load(productID)
@@ -362,15 +2580,12 @@ func postItem(c *gin.Context) {
     // if err := c.BindJSON(&newItem); err != nil {
     // 	return
     // }
-    var newDetails Item
-    if err := c.ShouldBindJSON(&newDetails); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{
-            "error":   "INVALID_INPUT",
-            "message": "The provided input data is invalid",
-            "details": err.Error(), // tells why decoding failed
-        })
+    var input ProductDetailsInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        writeProductBindError(c, err, err.Error())
         return
     }
+    newDetails := input.item()
 
     // Ensure the product ID in body matches the route parameter
     if newDetails.ID != productID {
@@ -381,11 +2596,422 @@ func postItem(c *gin.Context) {
         })
         return
     }
+    if problems := validateProductDetails(newDetails); len(problems) > 0 {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":   "INVALID_INPUT",
+            "message": "data input invalid",
+            "details": strings.Join(problems, "; "),
+        })
+        return
+    }
+
+    // Replace the stored details if nobody else edited the product since the
+    // client read it; newDetails.Version is the version it read
+    product, err := store.ReplaceProduct(c.Request.Context(), productItemFromItem(newDetails), newDetails.Version)
+    switch {
+    case errors.Is(err, ErrProductNotFound):
+        c.JSON(http.StatusNotFound, gin.H{
+            "error":   "NOT_FOUND",
+            "message": "product not found",
+            "details": fmt.Sprintf("no item with ID %d", productID),
+        })
+        return
+    case errors.Is(err, ErrVersionConflict):
+        c.JSON(http.StatusConflict, gin.H{
+            "error":   "CONFLICT",
+            "message": "product was modified since it was read, reload it and retry",
+            "details": err.Error(),
+        })
+        return
+    case err != nil:
+        log.Printf("Error replacing product: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error":   "INTERNAL_SERVER_ERROR",
+            "message": "something went wrong",
+            "details": "failed to update product",
+        })
+        return
+    }
+
+    // Keep the in-memory catalog in sync with DynamoDB
+    updated := product.ToItem()
+    storeProduct(updated)
+    noteProductCategory(updated.Category)
+
+    c.JSON(http.StatusOK, updated)
+}
+
+// validateProductDetails returns every problem with a product's details, as
+// checked before they are stored. Binding errors are reported separately.
+func validateProductDetails(item Item) []string {
+    var problems []string
+    if item.PriceCents < 0 {
+        problems = append(problems, "price_cents must not be negative")
+    }
+    return problems
+}
+
+// validateProduct checks a product payload with the same binding and
+// validation as postItem, without storing anything, so forms can report
+// errors before submitting
+// POST /products/validate
+func validateProduct(c *gin.Context) {
+    var input ProductDetailsInput
+    if err := c.ShouldBindJSON(&input); err != nil {
+        if reason, pos, ok := describeJSONError(err); ok {
+            c.JSON(http.StatusOK, gin.H{
+                "valid":    false,
+                "errors":   []string{reason},
+                "position": pos,
+            })
+            return
+        }
+        c.JSON(http.StatusOK, gin.H{
+            "valid":  false,
+            "errors": []string{err.Error()},
+        })
+        return
+    }
+
+    if problems := validateProductDetails(input.item()); len(problems) > 0 {
+        c.JSON(http.StatusOK, gin.H{
+            "valid":  false,
+            "errors": problems,
+        })
+        return
+    }
+    c.JSON(http.StatusOK, gin.H{"valid": true})
+}
+
+// patchProduct applies a partial update, leaving fields absent from the body
+// untouched. The version check is optional here: it's only made when the
+// body has a version.
+// PATCH /products/:productId
+func patchProduct(c *gin.Context) {
+    productID, ok := parseIntParam(c, "productId")
+    if !ok {
+        return
+    }
+
+    var patch ProductPatch
+    if err := c.ShouldBindJSON(&patch); err != nil {
+        writeProductBindError(c, err, err.Error())
+        return
+    }
+    if patch == (ProductPatch{Version: patch.Version}) {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":   "INVALID_INPUT",
+            "message": "data input invalid",
+            "details": "at least one field is required",
+        })
+        return
+    }
+    if patch.PriceCents != nil && *patch.PriceCents < 0 {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":   "INVALID_INPUT",
+            "message": "data input invalid",
+            "details": "price_cents must not be negative",
+        })
+        return
+    }
+
+    product, err := store.PatchProduct(c.Request.Context(), productID, patch)
+    if errors.Is(err, ErrProductNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{
+            "error":   "NOT_FOUND",
+            "message": "product not found",
+            "details": fmt.Sprintf("no item with ID %d", productID),
+        })
+        return
+    }
+    if errors.Is(err, ErrVersionConflict) {
+        c.JSON(http.StatusConflict, gin.H{
+            "error":   "CONFLICT",
+            "message": "product was modified since it was read, reload it and retry",
+            "details": err.Error(),
+        })
+        return
+    }
+    if err != nil {
+        log.Printf("Error patching product: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error":   "INTERNAL_SERVER_ERROR",
+            "message": "something went wrong",
+            "details": "failed to update product",
+        })
+        return
+    }
+
+    // Keep the in-memory catalog in sync with DynamoDB
+    updated := product.ToItem()
+    storeProduct(updated)
+    noteProductCategory(updated.Category)
+
+    c.JSON(http.StatusOK, updated)
+}
+
+// cloneProduct copies a product to a new, auto-generated ID, e.g. to create
+// a variant. Fields in the optional body override the copied ones; the SKU
+// must be overridden since SKUs identify a single product. The clone starts
+// with no stock, which is set through the stock endpoint.
+// POST /products/:productId/clone with an optional {"sku": ..., "name": ..., ...}
+func cloneProduct(c *gin.Context) {
+    productID, ok := parseIntParam(c, "productId")
+    if !ok {
+        return
+    }
+
+    // An empty body means no overrides
+    var overrides ProductPatch
+    if err := c.ShouldBindJSON(&overrides); err != nil && !errors.Is(err, io.EOF) {
+        writeProductBindError(c, err, err.Error())
+        return
+    }
+
+    ctx := c.Request.Context()
+    source, err := store.GetProduct(ctx, productID)
+    if errors.Is(err, ErrProductNotFound) {
+        c.JSON(http.StatusNotFound, gin.H{
+            "error":   "NOT_FOUND",
+            "message": "product not found",
+            "details": fmt.Sprintf("no item with ID %d", productID),
+        })
+        return
+    }
+    if err != nil {
+        log.Printf("Error getting product to clone: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error":   "INTERNAL_SERVER_ERROR",
+            "message": "something went wrong",
+            "details": "failed to get product",
+        })
+        return
+    }
+
+    clone := *source
+    overrides.applyTo(&clone)
+    clone.Stock, clone.Reserved, clone.Version, clone.Stale = 0, 0, 0, false
+    if clone.SKU == source.SKU {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":   "INVALID_INPUT",
+            "message": "data input invalid",
+            "details": "sku must be overridden with a new value",
+        })
+        return
+    }
+    if problems := validateProductDetails(clone.ToItem()); len(problems) > 0 {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":   "INVALID_INPUT",
+            "message": "data input invalid",
+            "details": strings.Join(problems, "; "),
+        })
+        return
+    }
+
+    created, err := store.CreateProduct(ctx, clone)
+    if err != nil {
+        log.Printf("Error cloning product %d: %v", productID, err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error":   "INTERNAL_SERVER_ERROR",
+            "message": "something went wrong",
+            "details": "failed to create product",
+        })
+        return
+    }
+
+    // Keep the in-memory catalog in sync with DynamoDB
+    item := created.ToItem()
+    storeProduct(item)
+    noteProductCategory(item.Category)
+
+    c.Header("Location", fmt.Sprintf("/products/%d", item.ID))
+    c.JSON(http.StatusCreated, item)
+}
+
+// maxPriceUpdates caps the size of one bulk price update request
+const maxPriceUpdates = 1000
+
+// updateProductPrices sets the price of many products at once, reporting
+// success or failure per product (e.g. a missing product fails only itself)
+// POST /products/prices with [{"product_id": n, "price_cents": n}, ...]
+func updateProductPrices(c *gin.Context) {
+    var updates []PriceUpdate
+    if err := c.ShouldBindJSON(&updates); err != nil {
+        writeProductBindError(c, err, err.Error())
+        return
+    }
+
+    var problems []string
+    if len(updates) == 0 || len(updates) > maxPriceUpdates {
+        problems = append(problems, fmt.Sprintf("between 1 and %d price updates are required", maxPriceUpdates))
+    }
+    seen := make(map[int]bool, len(updates))
+    for i, update := range updates {
+        switch {
+        case update.ProductID < 1:
+            problems = append(problems, fmt.Sprintf("item %d: product_id must be positive", i))
+        case seen[update.ProductID]:
+            problems = append(problems, fmt.Sprintf("item %d: duplicate product_id %d", i, update.ProductID))
+        }
+        // Binding has rejected entries without a price
+        if *update.PriceCents < 0 {
+            problems = append(problems, fmt.Sprintf("item %d: price_cents must not be negative", i))
+        }
+        seen[update.ProductID] = true
+    }
+    if len(problems) > 0 {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":   "INVALID_INPUT",
+            "message": "data input invalid",
+            "details": strings.Join(problems, "; "),
+        })
+        return
+    }
+
+    results := UpdatePrices(c.Request.Context(), updates)
+
+    updated := 0
+    for _, result := range results {
+        if !result.Success {
+            log.Printf("Error updating price of product %d: %s", result.ProductID, result.Error)
+            continue
+        }
+        updated++
+        // Keep the in-memory catalog in sync with DynamoDB
+        storeProduct(result.Product.ToItem())
+    }
+
+    c.JSON(http.StatusOK, gin.H{
+        "updated": updated,
+        "failed":  len(results) - updated,
+        "results": results,
+    })
+}
+
+// maxProductDeletes caps the size of one batch delete request
+const maxProductDeletes = 1000
+
+// deleteProducts removes many products at once, e.g. to clean up test data
+// (admin only)
+// DELETE /products with [productId, ...]
+func deleteProducts(c *gin.Context) {
+    var productIDs []int
+    if err := c.ShouldBindJSON(&productIDs); err != nil {
+        writeProductBindError(c, err, err.Error())
+        return
+    }
+    if len(productIDs) == 0 || len(productIDs) > maxProductDeletes {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":   "INVALID_INPUT",
+            "message": "data input invalid",
+            "details": fmt.Sprintf("between 1 and %d product IDs are required", maxProductDeletes),
+        })
+        return
+    }
+
+    deleted, notFound, err := DeleteProducts(c.Request.Context(), productIDs)
+    // Drop whatever was deleted from memory even if a later chunk failed
+    for _, productID := range deleted {
+        deleteProduct(productID)
+    }
+    if err != nil {
+        log.Printf("Error deleting products: %v", err)
+        c.JSON(http.StatusServiceUnavailable, gin.H{
+            "error":   "SERVICE_UNAVAILABLE",
+            "message": "Failed to delete products",
+            "details": fmt.Sprintf("%d products were deleted before the failure", len(deleted)),
+        })
+        return
+    }
+
+    if notFound == nil {
+        notFound = []int{}
+    }
+    c.JSON(http.StatusOK, gin.H{
+        "deleted":       len(deleted),
+        "not_found":     len(notFound),
+        "not_found_ids": notFound,
+    })
+}
+
+// updateProductStock adjusts or replaces a product's stock level
+// PATCH /products/:productId/stock with {"delta": n} or {"set": n}
+func updateProductStock(c *gin.Context) {
+    productID, ok := parseIntParam(c, "productId")
+    if !ok {
+        return
+    }
+
+    var input struct {
+        Delta *int `json:"delta"`
+        Set   *int `json:"set"`
+    }
+    err := c.ShouldBindJSON(&input)
+    if err != nil {
+        // An empty body is the only other way binding fails here
+        writeProductBindError(c, err, "exactly one of delta or set is required")
+        return
+    }
+    if (input.Delta == nil) == (input.Set == nil) {
+        c.JSON(http.StatusBadRequest, gin.H{
+            "error":   "INVALID_INPUT",
+            "message": "data input invalid",
+            "details": "exactly one of delta or set is required",
+        })
+        return
+    }
+
+    var stock int
+    if input.Set != nil {
+        if *input.Set < 0 {
+            c.JSON(http.StatusBadRequest, gin.H{
+                "error":   "INVALID_INPUT",
+                "message": "data input invalid",
+                "details": "set must not be negative",
+            })
+            return
+        }
+        stock, err = UpdateProductStock(c.Request.Context(), productID, *input.Set, true)
+    } else {
+        stock, err = UpdateProductStock(c.Request.Context(), productID, *input.Delta, false)
+    }
+
+    switch {
+    case errors.Is(err, ErrProductNotFound):
+        c.JSON(http.StatusNotFound, gin.H{
+            "error":   "NOT_FOUND",
+            "message": "product not found",
+            "details": fmt.Sprintf("no item with ID %d", productID),
+        })
+        return
+    case errors.Is(err, ErrInsufficientStock):
+        c.JSON(http.StatusConflict, gin.H{
+            "error":   "INSUFFICIENT_STOCK",
+            "message": "stock cannot go below zero",
+            "details": fmt.Sprintf("delta %d exceeds available stock", *input.Delta),
+        })
+        return
+    case err != nil:
+        log.Printf("Error updating stock: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{
+            "error":   "INTERNAL_SERVER_ERROR",
+            "message": "something went wrong",
+            "details": "failed to update stock",
+        })
+        return
+    }
 
-    // Add the new details to the corresponding product.
-    syncProducts.Store(productID, newDetails)
+    // Keep the in-memory catalog in sync with the new stock level
+    if value, exists := syncProducts.Load(productID); exists {
+        item := value.(Item)
+        item.Stock = stock
+        storeProduct(item)
+    }
 
-    c.Status(http.StatusNoContent)
+    c.JSON(http.StatusOK, gin.H{
+        "product_id": productID,
+        "stock":      stock,
+    })
 }
 
 // getItemByID locates the item whose ID value matches the productId
@@ -405,14 +3031,8 @@ func getItemByID(c *gin.Context) {
     // id := c.Param("productId") // "Context.Param()" retrieves the productId path parameter from the URL
 
     // Extract product ID from route
-    productIDStr := c.Param("productId")
-    productID, err := strconv.Atoi(productIDStr)
-    if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{
-            "error":   "INVALID_INPUT",
-            "message": "data input invalid",
-            "details": "invalid productID",
-        })
+    productID, ok := parseIntParam(c, "productId")
+    if !ok {
         return
     }
     // Check if product exists in map
@@ -426,7 +3046,25 @@ func getItemByID(c *gin.Context) {
         return
     }
 
+    item := value.(Item)
+
+    // With reservations, stock changes on every add-to-cart, so report the
+    // live available and reserved counts from DynamoDB
+    if reservationTTL > 0 {
+        product, err := store.GetProductAllowStale(c.Request.Context(), productID)
+        if err != nil {
+            log.Printf("Error getting product stock: %v", err)
+        } else {
+            item.Stock = product.Stock
+            item.Reserved = product.Reserved
+            item.Stale = product.Stale
+        }
+        c.IndentedJSON(http.StatusOK, item)
+        return
+    }
+
     // return "404 not found error" if the album is not found
-    c.IndentedJSON(http.StatusOK, value.(Item))
+    setProductCacheHeaders(c)
+    c.IndentedJSON(http.StatusOK, item)
 
 }
\ No newline at end of file
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve runs handler on one request with the given path parameters and JSON
+// body (none if empty) and returns the response
+func serve(handler gin.HandlerFunc, method, target string, params gin.Params, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		c.Request.Header.Set("Content-Type", "application/json")
+	}
+	c.Params = params
+	handler(c)
+	return w
+}
+
+// fakeCartStore is a Store with one product and an empty cart per customer,
+// recording the quantity of the last add. Other methods panic.
+type fakeCartStore struct {
+	Store
+	added int
+}
+
+func (s *fakeCartStore) GetProduct(ctx context.Context, productID int) (*ProductItem, error) {
+	return &ProductItem{ID: productID}, nil
+}
+
+func (s *fakeCartStore) AddToCart(ctx context.Context, customerID, productID, quantity int) (CartAction, int, error) {
+	s.added = quantity
+	return CartActionAdded, quantity, nil
+}
+
+func (s *fakeCartStore) GetCart(ctx context.Context, customerID int) (*CartItem, error) {
+	return &CartItem{CustomerID: customerID}, nil
+}
+
+func TestBuildCartResponseStableOrder(t *testing.T) {
+	lines := []CartProduct{
+		{ID: 30, Quantity: 1},
+		{ID: 10, Quantity: 2},
+		{ID: 20, Quantity: 3},
+	}
+	// The same cart read twice, stored in a different order the second time
+	first := buildCartResponse(&CartItem{CustomerID: 1, Items: lines}, nil)
+	reordered := []CartProduct{lines[2], lines[0], lines[1]}
+	second := buildCartResponse(&CartItem{CustomerID: 1, Items: reordered}, nil)
+
+	if !reflect.DeepEqual(first.Items, second.Items) {
+		t.Fatalf("items differ between reads:\n%+v\n%+v", first.Items, second.Items)
+	}
+	for i, want := range []int{10, 20, 30} {
+		item := first.Items[i]
+		if item.ProductID != want || item.ID != i+1 {
+			t.Errorf("item %d = product %d with id %d, want product %d with id %d", i, item.ProductID, item.ID, want, i+1)
+		}
+	}
+}
+
+// fillCatalog stores size products, all named "Product <id>", in the
+// in-memory catalog until the test ends
+func fillCatalog(t *testing.T, size int) {
+	for id := 1; id <= size; id++ {
+		storeProduct(Item{ID: id, Name: fmt.Sprintf("Product %d", id), Category: "Books", Brand: "Alpha"})
+	}
+	t.Cleanup(func() {
+		syncProducts.Clear()
+		productIDs.reset(nil)
+	})
+}
+
+// search runs a memory search and decodes the response
+func search(t *testing.T, query string) SearchResponse {
+	t.Helper()
+	w := serve(searchProducts, http.MethodGet, "/products/search?"+query, nil, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var response SearchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestSearchProductsTotalSearchedFullScan(t *testing.T) {
+	const catalogSize = 250
+	fillCatalog(t, catalogSize)
+
+	// Exact counting scans the whole catalog even though only one page is returned
+	response := search(t, "q=product&limit=5&count_mode=exact")
+	if response.TotalSearched != catalogSize {
+		t.Errorf("total_searched = %d, want the catalog size %d", response.TotalSearched, catalogSize)
+	}
+	if response.TotalFound != catalogSize {
+		t.Errorf("total_found = %d, want %d", response.TotalFound, catalogSize)
+	}
+}
+
+func TestBuildCartResponseSubtotals(t *testing.T) {
+	cart := &CartItem{Items: []CartProduct{
+		{ID: 1, Quantity: 1},
+		{ID: 2, Quantity: 3},
+		{ID: 3, Quantity: 12},
+		{ID: 4, Quantity: 2}, // unpriced
+		{ID: 5, Quantity: 1}, // product gone
+	}}
+	products := map[int]*ProductItem{
+		1: {ID: 1, PriceCents: 1999},
+		2: {ID: 2, PriceCents: 5},
+		3: {ID: 3, PriceCents: 250},
+		4: {ID: 4, Unpriced: true},
+	}
+
+	tests := []struct {
+		subtotalCents int
+		subtotal      string
+	}{
+		{1999, "$19.99"},
+		{15, "$0.15"},
+		{3000, "$30.00"},
+	}
+	response := buildCartResponse(cart, products)
+	for i, tt := range tests {
+		line := response.Items[i]
+		if line.SubtotalCents == nil || *line.SubtotalCents != tt.subtotalCents || line.Subtotal != tt.subtotal {
+			t.Errorf("product %d: subtotal = %v %q, want %d %q", line.ProductID, line.SubtotalCents, line.Subtotal, tt.subtotalCents, tt.subtotal)
+		}
+	}
+	for _, line := range response.Items[len(tests):] {
+		if line.SubtotalCents != nil || line.Subtotal != "" {
+			t.Errorf("product %d: subtotal = %v %q, want none", line.ProductID, line.SubtotalCents, line.Subtotal)
+		}
+	}
+	if !response.Items[4].Unavailable {
+		t.Error("line of a missing product not marked unavailable")
+	}
+}
+
+func TestAddItemToCartDefaultQuantity(t *testing.T) {
+	fake := &fakeCartStore{}
+	previous := store
+	store = fake
+	defer func() { store = previous }()
+
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		quantity int
+	}{
+		{"omitted", `{"product_id": 7}`, http.StatusOK, defaultCartQuantity},
+		{"explicit 1", `{"product_id": 7, "quantity": 1}`, http.StatusOK, 1},
+		{"explicit 0", `{"product_id": 7, "quantity": 0}`, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		fake.added = 0
+		params := gin.Params{{Key: "id", Value: "1"}}
+		w := serve(addItemToCart, http.MethodPost, "/shopping-carts/1/items", params, tt.body)
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d (body %s)", tt.name, w.Code, tt.status, w.Body)
+		}
+		if fake.added != tt.quantity {
+			t.Errorf("%s: added quantity %d, want %d", tt.name, fake.added, tt.quantity)
+		}
+	}
+}
+
+// fakeCreateStore is a Store whose GetCart and CreateCart fail with the
+// given errors, counting the creates. Other methods panic.
+type fakeCreateStore struct {
+	Store
+	getErr, createErr error
+	created           int
+}
+
+func (s *fakeCreateStore) GetCart(ctx context.Context, customerID int) (*CartItem, error) {
+	return nil, s.getErr
+}
+
+func (s *fakeCreateStore) CreateCart(ctx context.Context, customerID int) (*CartItem, error) {
+	s.created++
+	if s.createErr != nil {
+		return nil, s.createErr
+	}
+	return &CartItem{CustomerID: customerID}, nil
+}
+
+func TestCreateShoppingCartOnlyReplacesMissingCarts(t *testing.T) {
+	previous := store
+	defer func() { store = previous }()
+
+	tests := []struct {
+		name              string
+		getErr, createErr error
+		status, created   int
+	}{
+		{"no cart", ErrCartNotFound, nil, http.StatusCreated, 1},
+		{"live cart the read missed", ErrCartNotFound, fmt.Errorf("%w: customer 1", ErrCartExists), http.StatusOK, 1},
+		{"read failed", errors.New("throttled"), nil, http.StatusInternalServerError, 0},
+	}
+	for _, tt := range tests {
+		fake := &fakeCreateStore{getErr: tt.getErr, createErr: tt.createErr}
+		store = fake
+		w := serve(createShoppingCart, http.MethodPost, "/shopping-carts", nil, `{"customer_id": 1}`)
+		if w.Code != tt.status || fake.created != tt.created {
+			t.Errorf("%s: status %d with %d creates, want %d with %d", tt.name, w.Code, fake.created, tt.status, tt.created)
+		}
+	}
+}
+
+func TestSearchProductsPageModeStopsEarly(t *testing.T) {
+	const catalogSize = 250
+	fillCatalog(t, catalogSize)
+
+	// Every product matches, so a page of 5 is decided after 6 products:
+	// the 5 returned and one more showing there is a next page
+	page := search(t, "q=product&limit=5&count_mode=page")
+	exact := search(t, "q=product&limit=5&count_mode=exact")
+	if page.TotalSearched != 6 || exact.TotalSearched != catalogSize {
+		t.Errorf("total_searched = %d in page mode and %d in exact mode, want 6 and %d", page.TotalSearched, exact.TotalSearched, catalogSize)
+	}
+	if !reflect.DeepEqual(page.Data, exact.Data) || !reflect.DeepEqual(page.Pagination, exact.Pagination) {
+		t.Errorf("page and exact mode returned different pages: %+v, %+v", page.ListEnvelope, exact.ListEnvelope)
+	}
+	if page.Pagination.NextCursor == nil {
+		t.Fatal("page mode returned no next_cursor")
+	}
+
+	// The next page resumes after the cursor
+	next := search(t, "q=product&limit=5&count_mode=page&cursor="+*page.Pagination.NextCursor)
+	if len(next.Data) == 0 || next.Data[0].ID != 6 {
+		t.Errorf("second page = %+v, want it to start at product 6", next.Data)
+	}
+}
+
+func BenchmarkSearchProducts(b *testing.B) {
+	for id := 1; id <= 100000; id++ {
+		storeProduct(Item{ID: id, Name: fmt.Sprintf("Product %d", id)})
+	}
+	b.Cleanup(func() {
+		syncProducts.Clear()
+		productIDs.reset(nil)
+	})
+	for _, mode := range []string{countModePage, countModeExact} {
+		b.Run(mode, func(b *testing.B) {
+			for b.Loop() {
+				serve(searchProducts, http.MethodGet, "/products/search?q=product&count_mode="+mode, nil, "")
+			}
+		})
+	}
+}
+
+func TestSampleProductIDsDistinct(t *testing.T) {
+	const catalogSize = 50
+	fillCatalog(t, catalogSize)
+
+	for _, n := range []int{1, 10, catalogSize, catalogSize + 25} {
+		ids := sampleProductIDs(n)
+		if want := min(n, catalogSize); len(ids) != want {
+			t.Errorf("sampleProductIDs(%d) returned %d IDs, want %d", n, len(ids), want)
+		}
+		seen := make(map[int]bool, len(ids))
+		for _, id := range ids {
+			if seen[id] {
+				t.Errorf("sampleProductIDs(%d) returned %d twice: %v", n, id, ids)
+			}
+			if id < 1 || id > catalogSize {
+				t.Errorf("sampleProductIDs(%d) returned %d, not in the catalog", n, id)
+			}
+			seen[id] = true
+		}
+	}
+}
@@ -2,65 +2,576 @@ package main
 
 import (
 	"sync"
+	"sync/atomic"
+	"strconv"
 	"log"
+	"fmt"
+	"strings"
+	"slices"
+	"net/http"
+	"crypto/subtle"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
     "context"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
-    "github.com/aws/aws-sdk-go-v2/aws"
-    "github.com/aws/aws-sdk-go-v2/service/dynamodb"
 )
 
 // product map that stores all products
 var syncProducts sync.Map
+
+// serviceName identifies this API in the root descriptor
+const serviceName = "shopping-cart-service"
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+// startedAt is when the process started, for the uptime in /admin/stats
+var startedAt = time.Now()
+
+// seedingComplete is set once SeedData has finished (or wasn't needed)
+var seedingComplete atomic.Bool
+
+// popularityRanking is the latest ScanPopularity result, refreshed in the background
+var popularityRanking atomic.Pointer[[]ProductPopularity]
+
+// productCategories is the sorted list served by /products/categories: the
+// latest ScanCatalogFacets categories plus those this instance has seen
+// written since
+var productCategories atomic.Pointer[[]string]
+
+// productBrands is the latest ScanCatalogFacets brand counts, served by /products/brands
+var productBrands atomic.Pointer[[]BrandCount]
 // var products map[int]Item
 
-// Response structure
+// Pagination metadata shared by all list endpoints
+type Pagination struct {
+	NextCursor *string `json:"next_cursor"` // null on the last page
+	Limit      int     `json:"limit"`
+	Count      int     `json:"count"`
+}
+
+// ListEnvelope is the standard shape of every list response
+type ListEnvelope[T any] struct {
+	Data       []T        `json:"data"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// newListEnvelope wraps a page of results, an empty nextCursor marks the last page
+func newListEnvelope[T any](data []T, limit int, nextCursor string) ListEnvelope[T] {
+	// Return empty array instead of null
+	if data == nil {
+		data = []T{}
+	}
+	envelope := ListEnvelope[T]{
+		Data: data,
+		Pagination: Pagination{
+			Limit: limit,
+			Count: len(data),
+		},
+	}
+	if nextCursor != "" {
+		envelope.Pagination.NextCursor = &nextCursor
+	}
+	return envelope
+}
+
+// PopularProduct is a catalog item with its add-to-cart count
+type PopularProduct struct {
+	Item
+	Popularity int64 `json:"popularity"`
+}
+
+// Response structure. TotalFound counts every match in the catalog (not just
+// this page); TotalSearched is the number of products actually examined, which
+// for the full in-memory scan equals the catalog size.
 type SearchResponse struct {
-	Products      []Item `json:"products"`
+	ListEnvelope[Item]
 	TotalFound    int    `json:"total_found"`
-	TotalSearched int    `json:"total_searched"`
+	TotalSearched int    `json:"total_searched"` // products examined, not IDs attempted
 	SearchTime    string `json:"search_time"`
+	Source        string `json:"source"` // memory or dynamo
+	ScanLimited   bool   `json:"scan_limited"` // SEARCH_MAX_SCAN stopped the search early
+	CountMode     string `json:"count_mode"`   // page (TotalFound is a lower bound) or exact
+	Facets        SearchFacets `json:"facets"`
+}
+
+// SearchFacets counts the matches of a search per category and per brand,
+// for filter sidebars. With count_mode=exact they cover every match across
+// all pages, with count_mode=page only the products examined for this page.
+type SearchFacets struct {
+	Categories map[string]int `json:"categories"`
+	Brands     map[string]int `json:"brands"`
+}
+
+
+// authMiddleware requires "Authorization: Bearer <token>" on every route
+// except the /health checks when API_TOKEN is set. The admin token is also
+// accepted so admin requests only need one header. With no token configured
+// auth is disabled, which is convenient for local development.
+func authMiddleware(token, adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" || strings.HasPrefix(c.Request.URL.Path, "/health") {
+			c.Next()
+			return
+		}
+
+		if !bearerTokenMatches(c, token) && (adminToken == "" || !bearerTokenMatches(c, adminToken)) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "missing or invalid bearer token",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// adminAuthMiddleware protects admin routes, which expose all customer data,
+// with the ADMIN_TOKEN bearer token. Unlike authMiddleware it fails closed:
+// with no token configured the admin routes are disabled.
+func adminAuthMiddleware(adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if adminToken == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "admin endpoints are disabled, set ADMIN_TOKEN to enable them",
+			})
+			return
+		}
+
+		if !bearerTokenMatches(c, adminToken) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "admin token required",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// bearerTokenMatches reports whether the request carries "Authorization: Bearer <token>"
+func bearerTokenMatches(c *gin.Context, token string) bool {
+	provided, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	// Constant-time comparison avoids leaking the token through timing
+	return ok && subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+// readinessMiddleware returns 503 for every route except the health checks
+// until seeding completes, so early requests don't 404 on unseeded products
+func readinessMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if seedingComplete.Load() || strings.HasPrefix(c.Request.URL.Path, "/health") {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", "5")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error": "service is starting up, product seeding in progress",
+		})
+	}
+}
+
+// inflightLimitMiddleware caps the number of requests served concurrently.
+// A request waits up to wait for a free slot and is rejected with 503
+// otherwise, shedding load before the instance is overwhelmed. The /health
+// checks are exempt so an overloaded instance isn't also marked unhealthy.
+func inflightLimitMiddleware(limit int, wait time.Duration) gin.HandlerFunc {
+	slots := make(chan struct{}, limit)
+	return func(c *gin.Context) {
+		if strings.HasPrefix(c.Request.URL.Path, "/health") {
+			c.Next()
+			return
+		}
+
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case slots <- struct{}{}:
+		case <-timer.C:
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": "server is at capacity, try again later",
+			})
+			return
+		case <-c.Request.Context().Done():
+			c.Abort()
+			return
+		}
+		defer func() { <-slots }()
+		c.Next()
+	}
+}
+
+// requestTimeoutKey is the gin context key under which
+// requestTimeoutMiddleware stores its timeoutWriter
+const requestTimeoutKey = "requestTimeout"
+
+// requestTimeoutMiddleware gives each request an overall deadline. Handlers
+// pass the request context to every DynamoDB call and every wait (customer
+// locks, retry backoffs), so once it expires they return promptly; whatever
+// the handler then writes is discarded and the client gets 503 instead.
+// Routes whose jobs legitimately run long opt out with noRequestTimeout.
+func requestTimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parent := c.Request.Context()
+		ctx, cancel := context.WithTimeout(parent, timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		writer := &timeoutWriter{ResponseWriter: c.Writer, ctx: ctx, parent: parent}
+		c.Writer = writer
+		c.Set(requestTimeoutKey, writer)
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.timedOut && !c.Writer.Written() {
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": fmt.Sprintf("request timed out after %v", timeout),
+			})
+		}
+	}
+}
+
+// noRequestTimeout lifts the requestTimeoutMiddleware deadline for the
+// routes it's registered on, such as the admin jobs (consistency checks,
+// scans, bulk deletes)
+func noRequestTimeout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if value, ok := c.Get(requestTimeoutKey); ok {
+			writer := value.(*timeoutWriter)
+			writer.exempt = true
+			c.Request = c.Request.WithContext(writer.parent)
+		}
+		c.Next()
+	}
+}
+
+// timeoutWriter discards the response body once ctx has expired, so the
+// timeout middleware can answer with 503 instead of the handler's error
+type timeoutWriter struct {
+	gin.ResponseWriter
+	ctx      context.Context
+	parent   context.Context // the request context without the deadline
+	exempt   bool            // set by noRequestTimeout
+	timedOut bool
+}
+
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	if w.discard() {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	if w.discard() {
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+// discard reports whether writes should be dropped: the deadline passed
+// before anything was written
+func (w *timeoutWriter) discard() bool {
+	if !w.exempt && !w.timedOut && !w.ResponseWriter.Written() && errors.Is(w.ctx.Err(), context.DeadlineExceeded) {
+		w.timedOut = true
+	}
+	return w.timedOut
+}
+
+// requireJSON rejects requests whose body isn't declared as JSON with 415,
+// a clearer signal than the parse error ShouldBindJSON would return
+func requireJSON() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.ContentType() != gin.MIMEJSON {
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{
+				"error": "Content-Type must be application/json",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// noStoreMiddleware marks responses as uncacheable by browsers and CDNs
+func noStoreMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+		c.Next()
+	}
+}
+
+// dynamoCallsWriter adds the X-Dynamo-Calls header just before the response
+// is written, once the handler has made all of its DynamoDB calls
+type dynamoCallsWriter struct {
+	gin.ResponseWriter
+	calls *atomic.Int64
+}
+
+func (w *dynamoCallsWriter) setHeader() {
+	if !w.Written() {
+		w.Header().Set("X-Dynamo-Calls", strconv.FormatInt(w.calls.Load(), 10))
+	}
+}
+
+func (w *dynamoCallsWriter) WriteHeaderNow() {
+	w.setHeader()
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func (w *dynamoCallsWriter) Write(data []byte) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *dynamoCallsWriter) WriteString(s string) (int, error) {
+	w.setHeader()
+	return w.ResponseWriter.WriteString(s)
+}
+
+// dynamoCallsMiddleware counts the DynamoDB calls made while serving each
+// request and reports them in X-Dynamo-Calls, to help spot N+1 patterns
+func dynamoCallsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, calls := withDynamoCallCounter(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+		writer := &dynamoCallsWriter{ResponseWriter: c.Writer, calls: calls}
+		c.Writer = writer
+		c.Next()
+		// Bodiless responses (e.g. 204) are flushed by gin after the handler returns
+		writer.setHeader()
+	}
 }
 
+// refreshPopularity recomputes popularityRanking immediately and then every
+// interval. A failed scan keeps serving the previous ranking.
+func refreshPopularity(interval time.Duration) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		ranking, err := ScanPopularity(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("Warning: failed to refresh popularity ranking: %v", err)
+		} else {
+			popularityRanking.Store(&ranking)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// refreshCatalogFacets recomputes productCategories and productBrands
+// immediately and then every interval. A failed scan keeps serving the
+// previous lists.
+func refreshCatalogFacets(interval time.Duration) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		facets, err := ScanCatalogFacets(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("Warning: failed to refresh catalog facets: %v", err)
+		} else {
+			productCategories.Store(&facets.Categories)
+			productBrands.Store(&facets.Brands)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// noteProductCategory adds a category to productCategories right away when a
+// product is written, instead of waiting for the next refresh
+func noteProductCategory(category string) {
+	for {
+		current := productCategories.Load()
+		if current == nil || category == "" {
+			return // the first scan will pick it up
+		}
+		i, found := slices.BinarySearch(*current, category)
+		if found {
+			return
+		}
+		updated := slices.Insert(slices.Clone(*current), i, category)
+		if productCategories.CompareAndSwap(current, &updated) {
+			return
+		}
+	}
+}
+
+// sweepReservations releases expired stock reservations every interval
+func sweepReservations(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		released, err := SweepExpiredReservations(context.Background())
+		if err != nil {
+			log.Printf("Warning: reservation sweep failed: %v", err)
+		}
+		if released > 0 {
+			log.Printf("Released %d expired stock reservations", released)
+		}
+	}
+}
 
 func main() {
 	// Load .env file
-    if err := godotenv.Load(); err != nil {
+	envFileErr := godotenv.Load()
+    if envFileErr != nil {
         log.Println("No .env file found, using system environment variables")
     }
 
+	// Read and validate all configuration before touching AWS or binding the port
+	cfg, err := LoadConfig()
+	if err != nil {
+		if envFileErr != nil {
+			log.Fatalf("Invalid configuration:\n%v\nNo .env file was found either: export the variables above, or put them in a .env file in the working directory", err)
+		}
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	log.Printf("Effective configuration:\n  %s", cfg)
+
 	// Initialize DynamoDB connection
 	log.Println("Initializing DynamoDB...")
-	if err := InitDynamoDB(); err != nil {
+	shutdownTracing, err := InitTracing(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	if err := InitDynamoDB(cfg); err != nil {
 		log.Fatalf("Failed to initialize DynamoDB: %v", err)
 	}
 
 	// Generate products
     log.Println("Generating products...")
-    products := GenerateProducts(100000)
+    genConfig := GenConfig{}
+    // PRODUCT_GEN_CONFIG points to a JSON file with category weights for skewed catalogs
+    if cfg.ProductGenConfigPath != "" {
+        genConfig, err = LoadGenConfig(cfg.ProductGenConfigPath)
+        if err != nil {
+            log.Fatalf("Failed to load product generator config: %v", err)
+        }
+    }
+    products := GenerateProductsWithConfig(100000, genConfig)
     
+    // Cancelled on SIGTERM/SIGINT to shut down gracefully
+    ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+    defer stop()
+
     // Check if products table is empty, only seed if needed
-    ctx := context.Background()
-    result, _ := dynamoClient.Scan(ctx, &dynamodb.ScanInput{
-        TableName: aws.String(productsTable),
-        Limit:     aws.Int32(1), // Just check if any product exists
-    })
+    empty, reason, err := ProductsTableEmpty(ctx)
+    if err != nil {
+        // Don't assume the table is empty - reseeding could duplicate or clobber data
+        log.Fatalf("Failed to check whether products table %s is empty, aborting seeding: %v", productsTable, err)
+    }
+    // SEED_MODE=missing also seeds a non-empty table, skipping existing products
+    shouldSeed := empty || cfg.SeedMode == SeedModeMissing
+    log.Printf("Seeding decision: seed=%t (table empty=%t, mode %s): %s", shouldSeed, empty, cfg.SeedMode, reason)
     
-    if result == nil || len(result.Items) == 0 {
-        log.Println("Products table empty, seeding...")
-        if err := SeedData(products); err != nil {
-            log.Printf("Warning: failed to seed data: %v", err)
-        }
+	ids := make([]int, 0, len(products))
+	for k, v := range products {
+		syncProducts.Store(k, v)
+		ids = append(ids, k)
+	}
+	productIDs.reset(ids)
+
+    // Closed once background seeding has returned, so shutdown can wait for it
+    seedDone := make(chan struct{})
+    if shouldSeed {
+        // Seed in the background so the server (and /health) come up immediately,
+        // readiness is reported once seeding finishes
+        log.Printf("Seeding products (mode %s)...", cfg.SeedMode)
+        go func() {
+            defer close(seedDone)
+            // SEED_DRY_RUN=true reports the impact of seeding without writing anything
+            if err := SeedData(ctx, products, cfg.SeedDryRun); err != nil {
+                log.Printf("Warning: failed to seed data: %v", err)
+            }
+            seedingComplete.Store(true)
+        }()
     } else {
         log.Println("Products already seeded, skipping...")
+        close(seedDone)
+        seedingComplete.Store(true)
     }
 
-	for k, v := range products {
-		syncProducts.Store(k, v)
+	// Product reads may be cached for PRODUCT_CACHE_MAX_AGE seconds, 0 disables caching
+	if cfg.ProductCacheMaxAge > 0 {
+		productCacheControl = fmt.Sprintf("public, max-age=%d", cfg.ProductCacheMaxAge)
+	}
+
+	switch cfg.StoreBackend {
+	case StoreBackendDynamoDB:
+		store = dynamoStore{}
+	}
+
+	highlightPre, highlightPost = cfg.HighlightPre, cfg.HighlightPost
+	searchMaxScan = cfg.SearchMaxScan
+	healthLatencyThreshold = cfg.HealthLatencyLimit
+	taxRate = cfg.TaxRate
+	shippingRates = cfg.ShippingRates
+	defaultCartQuantity = cfg.DefaultCartQuantity
+
+	// Optionally coalesce add-to-cart writes, see CartWriteBuffer
+	if cfg.CartWriteBehind > 0 {
+		cartBuffer = NewCartWriteBuffer(cfg.CartWriteBehind)
+		log.Printf("Buffering cart adds, flushing every %v", cfg.CartWriteBehind)
+	}
+
+	// Optionally publish cart-change events, see CartEventEmitter
+	switch cfg.CartEventsSink {
+	case CartEventsSinkLog:
+		cartEvents = NewCartEventEmitter(LogCartEventSink{}, cfg.CartEventsBuffer)
+	case CartEventsSinkMemory:
+		cartEventsChannel = NewChannelCartEventSink(cfg.CartEventsBuffer)
+		cartEvents = NewCartEventEmitter(cartEventsChannel, cfg.CartEventsBuffer)
+	}
+
+	// Return expired stock reservations, checking at least once a minute
+	if cfg.ReservationTTL > 0 {
+		go sweepReservations(min(cfg.ReservationTTL, time.Minute))
+	}
+
+	// Keep the popularity ranking fresh for /products/popular
+	go refreshPopularity(cfg.PopularityRefresh)
+
+	// And the category and brand lists for /products/categories and /products/brands
+	go refreshCatalogFacets(cfg.FacetsRefresh)
+
+	// initialize Gin router with an explicit middleware stack. GIN_MODE
+	// defaults to release, which skips the debug route dump and warnings.
+	gin.SetMode(cfg.GinMode)
+	router := gin.New()
+	router.Use(accessLogMiddleware(cfg.LogFormat), gin.Recovery())
+
+	// Optional bearer-token auth, enabled when API_TOKEN is set
+	if cfg.APIToken == "" {
+		log.Println("API_TOKEN not set, authentication disabled")
+	}
+	if cfg.AdminToken == "" {
+		log.Println("ADMIN_TOKEN not set, admin endpoints are disabled")
+	}
+	// Tracing runs first so every request (including rejected ones) gets a span
+	router.Use(tracingMiddleware())
+	// Optional global cap on concurrent requests, enabled when MAX_INFLIGHT_REQUESTS is set
+	if cfg.MaxInflightRequests > 0 {
+		router.Use(inflightLimitMiddleware(cfg.MaxInflightRequests, cfg.InflightWait))
+	}
+	// Overall request deadline, enabled when REQUEST_TIMEOUT_MS is non-zero
+	if cfg.RequestTimeout > 0 {
+		router.Use(requestTimeoutMiddleware(cfg.RequestTimeout))
+	}
+	router.Use(authMiddleware(cfg.APIToken, cfg.AdminToken))
+	requireAdmin := adminAuthMiddleware(cfg.AdminToken)
+	// Admin jobs that scan or bulk-write are exempt from REQUEST_TIMEOUT_MS
+	longRunning := noRequestTimeout()
+	router.Use(readinessMiddleware())
+	if cfg.Debug {
+		router.Use(dynamoCallsMiddleware())
 	}
 
-	// initialize Gin router using Default
-	router := gin.Default()
+	// Service descriptor listing every endpoint
+	router.GET("/", serviceDescriptor(router))
 
 	// Health endpoint - checks DynamoDB connection
 	router.GET("/health", func(c *gin.Context) {
@@ -70,18 +581,130 @@ func main() {
 		})
 	})
 
+	// Readiness endpoint - 503 until product seeding has completed
+	router.GET("/health/ready", func(c *gin.Context) {
+		if !seedingComplete.Load() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"status": "seeding",
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"status": "ready",
+		})
+	})
+
+	// Detailed health, including the measured DynamoDB latency
+	router.GET("/health/detail", getHealthDetail)
+
 	// Shopping cart endpoints
-    router.POST("/shopping-carts", createShoppingCart)
-    router.GET("/shopping-carts/:id", getShoppingCart)
-    router.POST("/shopping-carts/:id/items", addItemToCart)
+	// Carts and wishlists are per-customer and mutable, so they are never cached
+    carts := router.Group("/shopping-carts", noStoreMiddleware())
+    carts.POST("", requireJSON(), createShoppingCart)
+    carts.GET("", requireAdmin, longRunning, listShoppingCarts)
+    carts.POST("/batch", requireAdmin, getShoppingCartsBatch)
+    carts.GET("/:id", getShoppingCart)
+    carts.PATCH("/:id", requireJSON(), patchShoppingCart)
+    carts.POST("/:id/validate", validateShoppingCart)
+    carts.POST("/:id/transfer", requireJSON(), transferShoppingCart)
+    carts.GET("/:id/total", getCartTotal)
+    carts.GET("/:id/shipping", getCartShipping)
+    carts.POST("/:id/promo", requireJSON(), applyCartPromo)
+    carts.DELETE("/:id/promo", removeCartPromo)
+    carts.POST("/:id/items", requireJSON(), addItemToCart)
+    carts.GET("/:id/items/:productId", getCartItem)
+    carts.POST("/:id/items/:productId/move", moveCartItem)
+
+	// Wishlist endpoints
+    wishlists := router.Group("/wishlists", noStoreMiddleware())
+    wishlists.GET("/:id", getWishlist)
+    wishlists.POST("/:id/items", addItemToWishlist)
+    wishlists.DELETE("/:id/items/:productId", removeItemFromWishlist)
+    wishlists.POST("/:id/items/:productId/move-to-cart", moveWishlistItemToCart)
+
+	// Customer data endpoints
+    customers := router.Group("/customers", noStoreMiddleware())
+    customers.GET("/:id/export", requireAdmin, exportCustomerData)
+    customers.DELETE("/:id/data", requireAdmin, deleteCustomerData)
+
+	// associate GET HTTP method and "/products?minWeight={w}&maxWeight={w}" path with a handler function "listProducts"
+	router.GET("/products", listProducts)
 	// associate GET HTTP method and "/products/{productId}" path with a handler function "getItemByID"
 	router.GET("/products/:productId", getItemByID)
 	// associate POST HTTP method and "/products/{productId}/details" path with a handler function "postItem"
-	router.POST("/products/:productId/details", postItem)
+	router.POST("/products/:productId/details", requireJSON(), postItem)
+	// associate PATCH HTTP method and "/products/{productId}" path with a handler function "patchProduct"
+	router.PATCH("/products/:productId", patchProduct)
+	// associate PATCH HTTP method and "/products/{productId}/stock" path with a handler function "updateProductStock"
+	router.PATCH("/products/:productId/stock", updateProductStock)
+	// associate POST HTTP method and "/products/{productId}/clone" path with a handler function "cloneProduct"
+	router.POST("/products/:productId/clone", cloneProduct)
+	// associate POST HTTP method and "/products/prices" path with a handler function "updateProductPrices"
+	router.POST("/products/prices", requireJSON(), updateProductPrices)
+	// associate POST HTTP method and "/products/validate" path with a handler function "validateProduct"
+	router.POST("/products/validate", requireJSON(), validateProduct)
+	// associate DELETE HTTP method and "/products" path with a handler function "deleteProducts" (admin only)
+	router.DELETE("/products", requireAdmin, longRunning, requireJSON(), deleteProducts)
+	// associate GET HTTP method and "/products/sku/{sku}" path with a handler function "getProductBySKU"
+	router.GET("/products/sku/:sku", getProductBySKU)
+	// associate GET HTTP method and "/products/by-name?name={name}" path with a handler function "getProductsByName"
+	router.GET("/products/by-name", getProductsByName)
+	// associate GET HTTP method and "/products/{productId}/carts" path with a handler function "getCartsWithProduct" (admin only)
+	router.GET("/products/:productId/carts", requireAdmin, longRunning, noStoreMiddleware(), getCartsWithProduct)
+	// associate GET HTTP method and "/products/categories" path with a handler function "getProductCategories"
+	router.GET("/products/categories", getProductCategories)
+	// associate GET HTTP method and "/products/brands" path with a handler function "getProductBrands"
+	router.GET("/products/brands", getProductBrands)
+	// associate GET HTTP method and "/products/popular?limit={n}" path with a handler function "getPopularProducts"
+	router.GET("/products/popular", getPopularProducts)
 	// associate GET HTTP method and "/products/search?q={query}" path with a handler function "searchProducts"
 	router.GET("/products/search", searchProducts)
+	// associate GET HTTP method and "/products/suggest?q={query}" path with a handler function "suggestProducts"
+	router.GET("/products/suggest", suggestProducts)
+
+	// Admin endpoints
+	admin := router.Group("/admin", requireAdmin, longRunning)
+	admin.GET("/consistency-check", consistencyCheck)
+	admin.GET("/raw/:table/:key", getRawItem)
+	admin.GET("/stats", getRuntimeStats)
+	admin.GET("/abandoned-products", getAbandonedProducts)
+	admin.POST("/estimate-capacity", requireJSON(), estimateCapacity)
+
 	printSample(products, 10)
 	log.Printf("Total products: %d", len(products))
-	// "Run()" attaches router to an http server and start the server
-	router.Run(":8080")
+	// Attach the router to an http server with the configured port and timeouts
+	server := &http.Server{
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
+		Handler:      router,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+	}
+	go func() {
+		log.Printf("Listening on %s", server.Addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	// Wait for a shutdown signal, then stop accepting requests and let
+	// in-flight requests and the current seeding batch finish
+	<-ctx.Done()
+	log.Println("Shutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Warning: server shutdown: %v", err)
+	}
+	if cartBuffer != nil {
+		cartBuffer.Stop(shutdownCtx)
+	}
+	if cartEvents != nil {
+		cartEvents.Stop(shutdownCtx)
+	}
+	select {
+	case <-seedDone:
+	case <-shutdownCtx.Done():
+		log.Println("Warning: timed out waiting for seeding to stop")
+	}
+	log.Println("Shutdown complete")
 }
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"slices"
+	"sync"
+)
+
+// productIDs holds every ID in syncProducts in ascending order, so search
+// can walk the catalog by ID and stop once a page is full instead of sorting
+// the whole catalog on every request. storeProduct and deleteProduct keep
+// the two in step.
+var productIDs sortedIDs
+
+// storeProduct adds or replaces a product in the in-memory catalog
+func storeProduct(item Item) {
+	syncProducts.Store(item.ID, item)
+	productIDs.add(item.ID)
+}
+
+// deleteProduct removes a product from the in-memory catalog
+func deleteProduct(productID int) {
+	syncProducts.Delete(productID)
+	productIDs.remove(productID)
+}
+
+// sortedIDs is a set of IDs kept in ascending order. Anything but appending
+// a new highest ID copies the slice, so a snapshot taken by after stays valid
+// without holding the lock.
+type sortedIDs struct {
+	mu  sync.RWMutex
+	ids []int
+}
+
+// reset replaces the set with ids, which it takes ownership of
+func (s *sortedIDs) reset(ids []int) {
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids = ids
+}
+
+// add inserts id if it is not in the set yet
+func (s *sortedIDs) add(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// New products get the highest ID so far, see nextProductID
+	if n := len(s.ids); n == 0 || id > s.ids[n-1] {
+		s.ids = append(s.ids, id)
+		return
+	}
+	pos, found := slices.BinarySearch(s.ids, id)
+	if found {
+		return
+	}
+	s.ids = slices.Concat(s.ids[:pos], []int{id}, s.ids[pos:])
+}
+
+// remove deletes id from the set if it is there
+func (s *sortedIDs) remove(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pos, found := slices.BinarySearch(s.ids, id)
+	if !found {
+		return
+	}
+	s.ids = slices.Concat(s.ids[:pos], s.ids[pos+1:])
+}
+
+// after returns the IDs above cursor in ascending order. The slice is shared
+// and must not be modified.
+func (s *sortedIDs) after(cursor int) []int {
+	s.mu.RLock()
+	ids := s.ids
+	s.mu.RUnlock()
+	pos, _ := slices.BinarySearch(ids, cursor+1)
+	return ids[pos:len(ids):len(ids)]
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortedIDs(t *testing.T) {
+	var ids sortedIDs
+	ids.reset([]int{5, 1, 3, 3})
+	ids.add(7) // new highest
+	ids.add(2) // in between
+	ids.add(5) // already there
+	ids.remove(3)
+	ids.remove(4) // not there
+
+	if got, want := ids.after(0), []int{1, 2, 5, 7}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after(0) = %v, want %v", got, want)
+	}
+	if got, want := ids.after(2), []int{5, 7}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after(2) = %v, want %v", got, want)
+	}
+
+	// A snapshot is unaffected by later writes
+	snapshot := ids.after(0)
+	ids.add(4)
+	ids.remove(1)
+	if want := []int{1, 2, 5, 7}; !reflect.DeepEqual(snapshot, want) {
+		t.Errorf("snapshot changed to %v, want %v", snapshot, want)
+	}
+}
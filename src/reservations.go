@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Stock reservations prevent overselling: when a product is added to a cart
+// its quantity moves from the product's stock (what's still available) to its
+// reserved counter. Each cart line records how much it holds and until when,
+// and a background sweeper returns expired reservations to stock.
+//
+// Reservations are disabled when reservationTTL is 0 (RESERVATION_TTL_MINUTES).
+// Items moved from a wishlist into a cart are not reserved until they are
+// added again.
+
+// maxSweepLines caps the lines released per cart per sweep, keeping the cart
+// write plus one update per line within TransactWriteItems' 100 item limit
+const maxSweepLines = 99
+
+// stockAdjustment is a quantity reserved or released for a product
+type stockAdjustment struct {
+	productID int
+	quantity  int
+}
+
+// ReserveStock moves quantity from a product's available stock to its
+// reserved counter, failing with ErrInsufficientStock if not enough is available
+func ReserveStock(ctx context.Context, productID, quantity int) error {
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(productsTable),
+		Key: map[string]types.AttributeValue{
+			"product_id": &types.AttributeValueMemberN{Value: strconv.Itoa(productID)},
+		},
+		UpdateExpression:    aws.String("SET stock = stock - :q, reserved = if_not_exists(reserved, :zero) + :q"),
+		ConditionExpression: aws.String("attribute_exists(product_id) AND stock >= :q"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":q":    &types.AttributeValueMemberN{Value: strconv.Itoa(quantity)},
+			":zero": &types.AttributeValueMemberN{Value: "0"},
+		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		var failed *types.ConditionalCheckFailedException
+		if errors.As(err, &failed) {
+			if failed.Item == nil {
+				return ErrProductNotFound
+			}
+			return fmt.Errorf("%w: product %d", ErrInsufficientStock, productID)
+		}
+		return fmt.Errorf("failed to reserve stock: %v", err)
+	}
+	return nil
+}
+
+// releaseStockUpdate returns quantity from a product's reserved counter to its stock
+func releaseStockUpdate(productID, quantity int) *types.Update {
+	return &types.Update{
+		TableName: aws.String(productsTable),
+		Key: map[string]types.AttributeValue{
+			"product_id": &types.AttributeValueMemberN{Value: strconv.Itoa(productID)},
+		},
+		UpdateExpression:    aws.String("SET stock = stock + :q, reserved = reserved - :q"),
+		ConditionExpression: aws.String("reserved >= :q"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":q": &types.AttributeValueMemberN{Value: strconv.Itoa(quantity)},
+		},
+	}
+}
+
+// ReleaseStock returns quantity from a product's reserved counter to its stock
+func ReleaseStock(ctx context.Context, productID, quantity int) error {
+	update := releaseStockUpdate(productID, quantity)
+	_, err := dynamoClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 update.TableName,
+		Key:                       update.Key,
+		UpdateExpression:          update.UpdateExpression,
+		ConditionExpression:       update.ConditionExpression,
+		ExpressionAttributeValues: update.ExpressionAttributeValues,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to release stock: %v", err)
+	}
+	return nil
+}
+
+// releaseAll best-effort releases adjustments, logging failures
+func releaseAll(ctx context.Context, adjustments []stockAdjustment) {
+	for _, adjustment := range adjustments {
+		if err := ReleaseStock(ctx, adjustment.productID, adjustment.quantity); err != nil {
+			log.Printf("Warning: failed to release %d of product %d: %v", adjustment.quantity, adjustment.productID, err)
+		}
+	}
+}
+
+// reserveCartLines brings the reservation of the given cart lines in line
+// with their quantities and extends their expiry. Increases are reserved
+// immediately (and rolled back if one fails); decreases are returned to be
+// released once the cart write has succeeded.
+func reserveCartLines(ctx context.Context, cart *CartItem, productIDs []int) (reserved, toRelease []stockAdjustment, err error) {
+	until := time.Now().Add(reservationTTL).Unix()
+	for _, productID := range productIDs {
+		for i := range cart.Items {
+			line := &cart.Items[i]
+			if line.ID != productID {
+				continue
+			}
+
+			switch delta := line.Quantity - line.Reserved; {
+			case delta > 0:
+				if err := ReserveStock(ctx, productID, delta); err != nil {
+					releaseAll(ctx, reserved)
+					return nil, nil, err
+				}
+				reserved = append(reserved, stockAdjustment{productID: productID, quantity: delta})
+			case delta < 0:
+				toRelease = append(toRelease, stockAdjustment{productID: productID, quantity: -delta})
+			}
+			line.Reserved = line.Quantity
+			line.ReservedUntil = until
+			break
+		}
+	}
+	return reserved, toRelease, nil
+}
+
+// SweepExpiredReservations returns the stock held by expired cart
+// reservations. Each cart is updated together with its products in one
+// transaction conditioned on the cart being unchanged, so a reservation is
+// never released twice; carts modified concurrently are retried next sweep.
+// It returns the number of cart lines released.
+func SweepExpiredReservations(ctx context.Context) (int, error) {
+	paginator := dynamodb.NewScanPaginator(dynamoClient, &dynamodb.ScanInput{
+		TableName: aws.String(cartsTable),
+	})
+
+	now := time.Now().Unix()
+	released := 0
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return released, fmt.Errorf("failed to scan carts: %v", err)
+		}
+		var carts []CartItem
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &carts); err != nil {
+			return released, fmt.Errorf("failed to unmarshal carts: %v", err)
+		}
+
+		for i := range carts {
+			cart := &carts[i]
+			var transactItems []types.TransactWriteItem
+			for j := range cart.Items {
+				line := &cart.Items[j]
+				if line.Reserved == 0 || line.ReservedUntil > now {
+					continue
+				}
+				if len(transactItems) == maxSweepLines {
+					break
+				}
+				transactItems = append(transactItems, types.TransactWriteItem{
+					Update: releaseStockUpdate(line.ID, line.Reserved),
+				})
+				line.Reserved = 0
+				line.ReservedUntil = 0
+			}
+			if len(transactItems) == 0 {
+				continue
+			}
+
+			// Bumping the version makes writers that read the cart before
+			// this sweep fail their conditional put instead of restoring the
+			// released reservation
+			previousVersion := cart.Version
+			cart.UpdatedAt = nowRFC3339()
+			cart.Version++
+			item, err := attributevalue.MarshalMap(cart)
+			if err != nil {
+				return released, fmt.Errorf("failed to marshal cart: %v", err)
+			}
+			transactItems = append(transactItems, types.TransactWriteItem{
+				Put: cartPutIfUnchanged(cartsTable, item, previousVersion),
+			})
+
+			_, err = dynamoClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+				TransactItems: transactItems,
+			})
+			if err != nil {
+				var cancelled *types.TransactionCanceledException
+				if errors.As(err, &cancelled) {
+					continue
+				}
+				return released, fmt.Errorf("failed to release reservations: %v", err)
+			}
+			released += len(transactItems) - 1
+		}
+	}
+	return released, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import "context"
+
+// store is the backend the cart and product handlers go through, selected by
+// STORE_BACKEND
+var store Store = dynamoStore{}
+
+// Store backends selectable with STORE_BACKEND
+const (
+	StoreBackendDynamoDB = "dynamodb"
+)
+
+// Store abstracts the core cart and product operations, so the same API can
+// be served (and benchmarked) over different databases. Errors use the
+// package sentinels (ErrCartNotFound, ErrProductNotFound, ErrCartFull, ...)
+// regardless of backend so handlers can map them to status codes.
+//
+// Only the operations on the main request paths are covered so far. Promos,
+// wishlists, reservations and the admin endpoints still call the DynamoDB
+// functions directly.
+type Store interface {
+	// Carts
+	GetCart(ctx context.Context, customerID int) (*CartItem, error)
+	CreateCart(ctx context.Context, customerID int) (*CartItem, error)
+	AddToCart(ctx context.Context, customerID, productID, quantity int) (CartAction, int, error)
+	SetCartItemQuantity(ctx context.Context, customerID, productID, quantity int) (CartAction, int, error)
+	UpdateCartMetadata(ctx context.Context, customerID int, metadata CartMetadata) (*CartItem, error)
+
+	// Products
+	GetProduct(ctx context.Context, productID int) (*ProductItem, error)
+	GetProducts(ctx context.Context, productIDs []int) (map[int]*ProductItem, error)
+	// The AllowStale variants may serve products marked Stale while the
+	// backend is down, for read-only endpoints only
+	GetProductAllowStale(ctx context.Context, productID int) (*ProductItem, error)
+	GetProductsAllowStale(ctx context.Context, productIDs []int) (map[int]*ProductItem, error)
+	PatchProduct(ctx context.Context, productID int, patch ProductPatch) (*ProductItem, error)
+	ReplaceProduct(ctx context.Context, product ProductItem, expectedVersion int) (*ProductItem, error)
+	CreateProduct(ctx context.Context, product ProductItem) (*ProductItem, error)
+}
+
+// dynamoStore is the DynamoDB Store, backed by the functions in dynamo.go
+type dynamoStore struct{}
+
+func (dynamoStore) GetCart(ctx context.Context, customerID int) (*CartItem, error) {
+	return GetCart(ctx, customerID)
+}
+
+func (dynamoStore) CreateCart(ctx context.Context, customerID int) (*CartItem, error) {
+	return CreateCart(ctx, customerID)
+}
+
+func (dynamoStore) AddToCart(ctx context.Context, customerID, productID, quantity int) (CartAction, int, error) {
+	return AddToCart(ctx, customerID, productID, quantity)
+}
+
+func (dynamoStore) SetCartItemQuantity(ctx context.Context, customerID, productID, quantity int) (CartAction, int, error) {
+	return SetCartItemQuantity(ctx, customerID, productID, quantity)
+}
+
+func (dynamoStore) UpdateCartMetadata(ctx context.Context, customerID int, metadata CartMetadata) (*CartItem, error) {
+	return UpdateCartMetadata(ctx, customerID, metadata)
+}
+
+func (dynamoStore) GetProduct(ctx context.Context, productID int) (*ProductItem, error) {
+	return GetProduct(ctx, productID)
+}
+
+func (dynamoStore) GetProducts(ctx context.Context, productIDs []int) (map[int]*ProductItem, error) {
+	return GetProducts(ctx, productIDs)
+}
+
+func (dynamoStore) GetProductAllowStale(ctx context.Context, productID int) (*ProductItem, error) {
+	return GetProductAllowStale(ctx, productID)
+}
+
+func (dynamoStore) GetProductsAllowStale(ctx context.Context, productIDs []int) (map[int]*ProductItem, error) {
+	return GetProductsAllowStale(ctx, productIDs)
+}
+
+func (dynamoStore) PatchProduct(ctx context.Context, productID int, patch ProductPatch) (*ProductItem, error) {
+	return PatchProduct(ctx, productID, patch)
+}
+
+func (dynamoStore) ReplaceProduct(ctx context.Context, product ProductItem, expectedVersion int) (*ProductItem, error) {
+	return ReplaceProduct(ctx, product, expectedVersion)
+}
+
+func (dynamoStore) CreateProduct(ctx context.Context, product ProductItem) (*ProductItem, error) {
+	return CreateProduct(ctx, product)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer is used for both request and DynamoDB spans. Until InitTracing
+// installs a real provider it is backed by the global no-op provider.
+var tracer = otel.Tracer("text/main")
+
+// InitTracing installs an OTLP/HTTP tracer provider when an exporter endpoint
+// is configured. The exporter reads the standard OTEL_EXPORTER_OTLP_* variables
+// (endpoint, headers, TLS) itself, and the service name comes from
+// OTEL_SERVICE_NAME. Without an endpoint tracing stays a no-op.
+//
+// The returned function flushes buffered spans and should be called on shutdown.
+func InitTracing(appConfig *Config) (func(context.Context) error, error) {
+	if appConfig.OTLPEndpoint == "" {
+		log.Println("No OTLP endpoint configured, tracing disabled")
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.Default()),
+	)
+	otel.SetTracerProvider(provider)
+	// Continue traces started upstream (e.g. by the ALB or a caller)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	log.Printf("Tracing enabled, exporting to %s", appConfig.OTLPEndpoint)
+	return provider.Shutdown, nil
+}
+
+// tracingMiddleware starts a server span per request, named after the matched
+// route, and stores it in the request context so DynamoDB calls made with
+// c.Request.Context() become its children
+func tracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(),
+			propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx, span := tracer.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", c.Request.URL.Path),
+			))
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+		}
+	}
+}
+
+// dynamoTracingMiddleware registers a middleware that wraps every DynamoDB
+// operation (including SDK retries) in a client span tagged with the
+// operation and table name
+func dynamoTracingMiddleware(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("Tracing",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+			operation := middleware.GetOperationName(ctx)
+			ctx, span := tracer.Start(ctx, "DynamoDB."+operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					attribute.String("db.system", "dynamodb"),
+					attribute.String("db.operation.name", operation),
+				))
+			defer span.End()
+
+			if table := tableNameOf(in.Parameters); table != "" {
+				span.SetAttributes(attribute.String("aws.dynamodb.table_names", table))
+			}
+
+			out, metadata, err := next.HandleInitialize(ctx, in)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return out, metadata, err
+		}), middleware.Before)
+}
+
+// tableNameOf returns the table of single-table operations. Batch and
+// transaction inputs span several tables and return "".
+func tableNameOf(params any) string {
+	var table *string
+	switch input := params.(type) {
+	case *dynamodb.GetItemInput:
+		table = input.TableName
+	case *dynamodb.PutItemInput:
+		table = input.TableName
+	case *dynamodb.UpdateItemInput:
+		table = input.TableName
+	case *dynamodb.DeleteItemInput:
+		table = input.TableName
+	case *dynamodb.QueryInput:
+		table = input.TableName
+	case *dynamodb.ScanInput:
+		table = input.TableName
+	}
+	if table == nil {
+		return ""
+	}
+	return *table
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"math/rand"
+	"os"
+	"sort"
 	"strings"
 	// "time"
 )
@@ -23,24 +26,24 @@ type Item struct {
 	Category     string	 `json:"category"`
 	Description  string  `json:"description"`
 	Brand		 string  `json:"brand"`
+	PriceCents   int     `json:"price_cents"`
+	Stock        int     `json:"stock"`    // available, excluding reserved
+	Reserved     int     `json:"reserved"` // held by cart reservations
+	Version      int     `json:"version"`  // send back on edits, see ProductPatch.Version
+	Stale        bool    `json:"stale,omitempty"`
 }
 
 
-func GenerateProducts(count int) map[int]Item {
-	// rand.Seed(time.Now().UnixNano())
-	
-	products := make(map[int]Item)
-	usedSKUs := make(map[string]bool)
-	
-	manufacturers := []string{
-		"Muji", "Pilot", "Jans Sports", "Nike", "Adidas",
-		"Apple", "Samsung", "Sony", "Dell", "HP",
-		"Lenovo", "Asus", "Microsoft", "Amazon", "Google",
-		"Patagonia", "North Face", "Columbia", "Under Armour", "Puma",
-		"Reebok", "New Balance", "Vans", "Converse", "Timberland",
-	}
+var manufacturers = []string{
+	"Muji", "Pilot", "Jans Sports", "Nike", "Adidas",
+	"Apple", "Samsung", "Sony", "Dell", "HP",
+	"Lenovo", "Asus", "Microsoft", "Amazon", "Google",
+	"Patagonia", "North Face", "Columbia", "Under Armour", "Puma",
+	"Reebok", "New Balance", "Vans", "Converse", "Timberland",
+}
 
-	categories := []string{
+// categories[i] is the category of manufacturers[i]
+var categories = []string{
     "Stationery",        // Muji
     "Pen",              // Pilot
     "Backpacks",         // Jans Sports (JanSport)
@@ -67,6 +70,95 @@ func GenerateProducts(count int) map[int]Item {
     "Footwear",          // Converse
     "Footwear",          // Timberland
 }
+
+// GenConfig controls product generation. CategoryWeights maps a category
+// name to its relative frequency; categories missing from the map are never
+// generated. An empty map keeps the default uniform choice of manufacturer.
+type GenConfig struct {
+	CategoryWeights map[string]float64 `json:"category_weights"`
+}
+
+// LoadGenConfig reads and validates a GenConfig from a JSON file
+func LoadGenConfig(path string) (GenConfig, error) {
+	var cfg GenConfig
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read generator config: %v", err)
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse generator config: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// Validate checks that every weighted category exists and that weights are usable
+func (cfg GenConfig) Validate() error {
+	known := make(map[string]bool, len(categories))
+	for _, category := range categories {
+		known[category] = true
+	}
+
+	total := 0.0
+	for category, weight := range cfg.CategoryWeights {
+		if !known[category] {
+			return fmt.Errorf("unknown category %q in generator config", category)
+		}
+		if weight < 0 {
+			return fmt.Errorf("negative weight for category %q", category)
+		}
+		total += weight
+	}
+	if len(cfg.CategoryWeights) > 0 && total == 0 {
+		return fmt.Errorf("category weights must not all be zero")
+	}
+
+	return nil
+}
+
+// manufacturerPicker returns a function choosing a manufacturer index. With
+// category weights, each category's weight is split evenly between its
+// manufacturers so categories appear in the configured proportions.
+func manufacturerPicker(cfg GenConfig) func() int {
+	if len(cfg.CategoryWeights) == 0 {
+		return func() int { return rand.Intn(len(manufacturers)) }
+	}
+
+	perCategory := make(map[string]int)
+	for _, category := range categories {
+		perCategory[category]++
+	}
+
+	// Cumulative weights over manufacturer indices
+	cumulative := make([]float64, len(manufacturers))
+	total := 0.0
+	for i, category := range categories {
+		total += cfg.CategoryWeights[category] / float64(perCategory[category])
+		cumulative[i] = total
+	}
+
+	return func() int {
+		r := rand.Float64() * total
+		return sort.Search(len(cumulative), func(i int) bool { return cumulative[i] > r })
+	}
+}
+
+func GenerateProducts(count int) map[int]Item {
+	return GenerateProductsWithConfig(count, GenConfig{})
+}
+
+// GenerateProductsWithConfig generates count products, choosing categories
+// according to cfg (which should already be validated)
+func GenerateProductsWithConfig(count int, cfg GenConfig) map[int]Item {
+	// rand.Seed(time.Now().UnixNano())
+	
+	products := make(map[int]Item)
+	usedSKUs := make(map[string]bool)
+	pickManufacturer := manufacturerPicker(cfg)
 	
 	for i := 1; i <= count; i++ {
 		// Generate unique SKU
@@ -74,7 +166,7 @@ func GenerateProducts(count int) map[int]Item {
 		usedSKUs[sku] = true
 		
 		// Random manufacturer
-		random_index := rand.Intn(len(manufacturers))
+		random_index := pickManufacturer()
 		manufacturer := manufacturers[random_index]
 		
 		// Random category ID (100-999)
@@ -85,6 +177,12 @@ func GenerateProducts(count int) map[int]Item {
 		weight := rand.Float64()*49.9 + 0.1
 		weight = float64(int(weight*10)) / 10 // Round to 1 decimal place
 		
+		// Random starting stock (10-1000)
+		stock := rand.Intn(991) + 10
+
+		// Random price ($0.99 to $499.99)
+		priceCents := rand.Intn(49901) + 99
+
 		// Random some other ID (100-9999)
 		someOtherID := rand.Intn(9900) + 100
 		name := fmt.Sprintf("Product %s %d", manufacturer, i)
@@ -101,6 +199,8 @@ func GenerateProducts(count int) map[int]Item {
 			Category:     category,
 			Description:  description,
 			Brand:        manufacturer,
+			PriceCents:   priceCents,
+			Stock:        stock,
 		}
 		
 		products[i] = item
@@ -231,4 +331,3 @@ func FormatProductsAsString(products map[int]Item) string {
 	sb.WriteString("}")
 	return sb.String()
 }
-
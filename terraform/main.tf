@@ -28,10 +28,13 @@ module "logging" {
 
 # DynamoDB Tables
 module "dynamodb" {
-  source              = "./modules/dynamodb"
-  service_name        = var.service_name
-  products_table_name = var.products_table_name
-  carts_table_name    = var.carts_table_name
+  source               = "./modules/dynamodb"
+  service_name         = var.service_name
+  products_table_name  = var.products_table_name
+  carts_table_name     = var.carts_table_name
+  wishlists_table_name = var.wishlists_table_name
+  promos_table_name    = var.promos_table_name
+  counters_table_name  = var.counters_table_name
 }
 
 # Reuse an existing IAM role for ECS tasks
@@ -60,8 +63,11 @@ module "ecs" {
   max_capacity = var.max_capacity
 
   # Pass DynamoDB table names as environment variables
-  products_table_name = module.dynamodb.products_table_name
-  carts_table_name    = module.dynamodb.carts_table_name
+  products_table_name  = module.dynamodb.products_table_name
+  carts_table_name     = module.dynamodb.carts_table_name
+  wishlists_table_name = module.dynamodb.wishlists_table_name
+  promos_table_name    = module.dynamodb.promos_table_name
+  counters_table_name  = module.dynamodb.counters_table_name
 }
 
 
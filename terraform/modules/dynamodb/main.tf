@@ -9,6 +9,18 @@ resource "aws_dynamodb_table" "products" {
     type = "N"  # Number type
   }
 
+  attribute {
+    name = "sku"
+    type = "S"  # String type
+  }
+
+  # Lookup by SKU (GET /products/sku/:sku), queried as "sku-index"
+  global_secondary_index {
+    name            = "sku-index"
+    hash_key        = "sku"
+    projection_type = "ALL"
+  }
+
   tags = {
     Name        = var.products_table_name
     Environment = "dev"
@@ -27,9 +39,69 @@ resource "aws_dynamodb_table" "carts" {
     type = "N"  # Number type
   }
 
+  # Abandoned carts are deleted after their expires_at (epoch seconds) passes
+  ttl {
+    attribute_name = "expires_at"
+    enabled        = true
+  }
+
   tags = {
     Name        = var.carts_table_name
     Environment = "dev"
     Service     = var.service_name
   }
+}
+
+# DynamoDB table for wishlists (same shape and key as carts)
+resource "aws_dynamodb_table" "wishlists" {
+  name           = var.wishlists_table_name
+  billing_mode   = "PAY_PER_REQUEST"  # On-demand billing
+  hash_key       = "customer_id"
+
+  attribute {
+    name = "customer_id"
+    type = "N"  # Number type
+  }
+
+  tags = {
+    Name        = var.wishlists_table_name
+    Environment = "dev"
+    Service     = var.service_name
+  }
+}
+
+# DynamoDB table for promo codes (code -> percent or fixed discount, expiry)
+resource "aws_dynamodb_table" "promos" {
+  name           = var.promos_table_name
+  billing_mode   = "PAY_PER_REQUEST"  # On-demand billing
+  hash_key       = "code"
+
+  attribute {
+    name = "code"
+    type = "S"  # String type
+  }
+
+  tags = {
+    Name        = var.promos_table_name
+    Environment = "dev"
+    Service     = var.service_name
+  }
+}
+
+# DynamoDB table for atomic counters (name -> value), e.g. the next product ID
+resource "aws_dynamodb_table" "counters" {
+  name           = var.counters_table_name
+  billing_mode   = "PAY_PER_REQUEST"  # On-demand billing
+  hash_key       = "name"
+
+  attribute {
+    name = "name"
+    type = "S"  # String type
+  }
+
+  tags = {
+    Name        = var.counters_table_name
+    Environment = "dev"
+    Service     = var.service_name
+  }
 }
\ No newline at end of file
@@ -16,4 +16,34 @@ output "carts_table_name" {
 output "carts_table_arn" {
   description = "ARN of the carts DynamoDB table"
   value       = aws_dynamodb_table.carts.arn
-}
\ No newline at end of file
+}
+
+output "wishlists_table_name" {
+  description = "Name of the wishlists DynamoDB table"
+  value       = aws_dynamodb_table.wishlists.name
+}
+
+output "wishlists_table_arn" {
+  description = "ARN of the wishlists DynamoDB table"
+  value       = aws_dynamodb_table.wishlists.arn
+}
+
+output "promos_table_name" {
+  description = "Name of the promos DynamoDB table"
+  value       = aws_dynamodb_table.promos.name
+}
+
+output "promos_table_arn" {
+  description = "ARN of the promos DynamoDB table"
+  value       = aws_dynamodb_table.promos.arn
+}
+
+output "counters_table_name" {
+  description = "Name of the counters DynamoDB table"
+  value       = aws_dynamodb_table.counters.name
+}
+
+output "counters_table_arn" {
+  description = "ARN of the counters DynamoDB table"
+  value       = aws_dynamodb_table.counters.arn
+}
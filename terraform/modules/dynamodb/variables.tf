@@ -13,4 +13,22 @@ variable "carts_table_name" {
   description = "Name of the DynamoDB carts table"
   type        = string
   default     = "ecommerce-carts"
-}
\ No newline at end of file
+}
+
+variable "wishlists_table_name" {
+  description = "Name of the DynamoDB wishlists table"
+  type        = string
+  default     = "ecommerce-wishlists"
+}
+
+variable "promos_table_name" {
+  description = "Name of the DynamoDB promos table"
+  type        = string
+  default     = "ecommerce-promos"
+}
+
+variable "counters_table_name" {
+  description = "Name of the DynamoDB counters table"
+  type        = string
+  default     = "ecommerce-counters"
+}
@@ -35,6 +35,18 @@ resource "aws_ecs_task_definition" "this" {
       {
         name  = "CARTS_TABLE"
         value = var.carts_table_name
+      },
+      {
+        name  = "WISHLISTS_TABLE"
+        value = var.wishlists_table_name
+      },
+      {
+        name  = "PROMOS_TABLE"
+        value = var.promos_table_name
+      },
+      {
+        name  = "COUNTERS_TABLE"
+        value = var.counters_table_name
       }
     ]
     
@@ -91,4 +91,19 @@ variable "products_table_name" {
 variable "carts_table_name" {
   description = "Name of the DynamoDB carts table"
   type        = string
-}
\ No newline at end of file
+}
+
+variable "wishlists_table_name" {
+  description = "Name of the DynamoDB wishlists table"
+  type        = string
+}
+
+variable "promos_table_name" {
+  description = "Name of the DynamoDB promos table"
+  type        = string
+}
+
+variable "counters_table_name" {
+  description = "Name of the DynamoDB counters table"
+  type        = string
+}
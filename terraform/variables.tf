@@ -55,4 +55,22 @@ variable "carts_table_name" {
   type        = string
   description = "Name of the DynamoDB carts table"
   default     = "ecommerce-carts"
-}
\ No newline at end of file
+}
+
+variable "wishlists_table_name" {
+  type        = string
+  description = "Name of the DynamoDB wishlists table"
+  default     = "ecommerce-wishlists"
+}
+
+variable "promos_table_name" {
+  type        = string
+  description = "Name of the DynamoDB promos table"
+  default     = "ecommerce-promos"
+}
+
+variable "counters_table_name" {
+  type        = string
+  description = "Name of the DynamoDB counters table"
+  default     = "ecommerce-counters"
+}
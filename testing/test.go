@@ -3,12 +3,21 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"math"
 	"math/rand"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -23,6 +32,13 @@ const (
 	TimeLimit     = 5 * time.Minute
 )
 
+// Error categories recorded on failed results
+const (
+	ErrConnection = "connection_error" // request never got a response
+	ErrHTTPStatus = "http_error"       // response with an unexpected status code
+	ErrVerify     = "verify_error"     // add succeeded but the item is missing from the cart (-verify)
+)
+
 // TestResult represents a single operation result
 type TestResult struct {
 	Operation    string  `json:"operation"`
@@ -31,12 +47,23 @@ type TestResult struct {
 	StatusCode   int     `json:"status_code"`
 	Timestamp    string  `json:"timestamp"`
 	CustomerID   int     `json:"customer_id,omitempty"`
+	ErrorType    string  `json:"error_type,omitempty"`
 }
 
 // TestOutput represents the complete test output
 type TestOutput struct {
-	Results    []TestResult       `json:"results"`
-	Statistics map[string]OpStats `json:"statistics"`
+	Results    []TestResult                 `json:"results"`
+	Statistics map[string]OpStats           `json:"statistics"`
+	Histograms map[string][]HistogramBucket `json:"histograms"`
+}
+
+// HistogramBucket counts the results of one operation whose response time
+// falls in [MinMs, MaxMs). MaxMs is omitted for the last, open-ended bucket.
+type HistogramBucket struct {
+	Label string   `json:"label"`
+	MinMs float64  `json:"min_ms"`
+	MaxMs *float64 `json:"max_ms,omitempty"`
+	Count int      `json:"count"`
 }
 
 // OpStats represents statistics for an operation type
@@ -47,25 +74,197 @@ type OpStats struct {
 	AvgResponseTime   float64 `json:"avg_response_time"`
 	MinResponseTime   float64 `json:"min_response_time"`
 	MaxResponseTime   float64 `json:"max_response_time"`
+	P99ResponseTime   float64 `json:"p99_response_time"`
 	TotalResponseTime float64 `json:"total_response_time"`
 }
 
+// Duration is a time.Duration read from JSON as a string such as "30s"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %v", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// TestConfig is the configuration of a run. It can be loaded from a JSON file
+// with -config; flags given on the command line override the file.
+type TestConfig struct {
+	BaseURL             string   `json:"base_url"`
+	NumCreateCart       int      `json:"num_create_cart"`
+	NumAddItems         int      `json:"num_add_items"`
+	NumGetCart          int      `json:"num_get_cart"`
+	Workers             int      `json:"workers"`
+	RampUp              Duration `json:"ramp_up"` // spread the start of the workers over this long
+	RequestTimeout      Duration `json:"request_timeout"`
+	DialTimeout         Duration `json:"dial_timeout"`
+	KeepAlive           bool     `json:"keep_alive"`
+	MaxIdleConns        int      `json:"max_idle_conns"`
+	MaxIdleConnsPerHost int      `json:"max_idle_conns_per_host"`
+	MaxConnsPerHost     int      `json:"max_conns_per_host"`
+	HistogramBuckets    string   `json:"histogram_buckets"`
+	Verify              bool     `json:"verify"` // GET the cart after each add and check the item is there
+
+	// SLOs checked at the end of the run; the run fails if any is breached.
+	// Zero disables a check.
+	MaxP99         float64 `json:"max_p99"`          // ms, per operation
+	MinSuccessRate float64 `json:"min_success_rate"` // percent, over all operations
+}
+
+// validate checks that the configuration can be run
+func (c TestConfig) validate() error {
+	var problems []error
+	if c.BaseURL == "" {
+		problems = append(problems, errors.New("base URL is required (base_url or the ALB_URL argument)"))
+	}
+	if c.NumCreateCart <= 0 || c.NumAddItems < 0 || c.NumGetCart < 0 {
+		problems = append(problems, errors.New("num_create_cart must be positive and the other counts non-negative"))
+	}
+	if c.Workers <= 0 {
+		problems = append(problems, errors.New("workers must be positive"))
+	}
+	if c.RampUp < 0 || c.RequestTimeout <= 0 || c.DialTimeout <= 0 {
+		problems = append(problems, errors.New("timeouts must be positive and ramp_up non-negative"))
+	}
+	if c.MaxIdleConns < 0 || c.MaxIdleConnsPerHost < 0 || c.MaxConnsPerHost < 0 {
+		problems = append(problems, errors.New("connection limits must not be negative"))
+	}
+	if c.MaxP99 < 0 || c.MinSuccessRate < 0 || c.MinSuccessRate > 100 {
+		problems = append(problems, errors.New("max_p99 must not be negative and min_success_rate must be between 0 and 100"))
+	}
+	return errors.Join(problems...)
+}
+
 var (
+	cfg = TestConfig{
+		NumCreateCart:       NumCreateCart,
+		NumAddItems:         NumAddItems,
+		NumGetCart:          NumGetCart,
+		Workers:             NumWorkers,
+		RequestTimeout:      Duration(30 * time.Second),
+		DialTimeout:         Duration(5 * time.Second),
+		KeepAlive:           true,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 100,
+		HistogramBuckets:    "10,50,100,250,500,1000",
+	}
+
 	baseURL        string
 	results        []TestResult
 	resultsMutex   sync.Mutex
 	httpClient     *http.Client
+
+	// Connection reuse counters, see connTrackingTransport
+	newConns    atomic.Int64
+	reusedConns atomic.Int64
 )
 
+// connTrackingTransport records, through httptrace, whether each request
+// got a new or a reused (keep-alive) connection
+type connTrackingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *connTrackingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				reusedConns.Add(1)
+			} else {
+				newConns.Add(1)
+			}
+		},
+	}
+	return t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+}
+
+// loadConfig builds the run configuration from the defaults, the -config
+// file and the command line, in increasing order of precedence
+func loadConfig() {
+	configPath := flag.String("config", "", "JSON file with the test configuration (flags override it)")
+	flag.IntVar(&cfg.NumCreateCart, "num-create-cart", cfg.NumCreateCart, "number of create cart operations")
+	flag.IntVar(&cfg.NumAddItems, "num-add-items", cfg.NumAddItems, "number of add item operations")
+	flag.IntVar(&cfg.NumGetCart, "num-get-cart", cfg.NumGetCart, "number of get cart operations")
+	flag.IntVar(&cfg.Workers, "workers", cfg.Workers, "number of concurrent workers")
+	flag.DurationVar((*time.Duration)(&cfg.RampUp), "ramp-up", time.Duration(cfg.RampUp), "spread the start of the workers over this long in each phase")
+	flag.DurationVar((*time.Duration)(&cfg.RequestTimeout), "request-timeout", time.Duration(cfg.RequestTimeout), "timeout for each request")
+	// Connection pool tuning, so the load generator itself isn't the bottleneck.
+	// Go's default transport keeps only 2 idle connections per host.
+	flag.IntVar(&cfg.MaxIdleConns, "max-idle-conns", cfg.MaxIdleConns, "maximum idle connections across all hosts")
+	flag.IntVar(&cfg.MaxIdleConnsPerHost, "max-idle-conns-per-host", cfg.MaxIdleConnsPerHost, "maximum idle connections per host")
+	flag.IntVar(&cfg.MaxConnsPerHost, "max-conns-per-host", cfg.MaxConnsPerHost, "maximum connections per host (0 = unlimited)")
+	flag.BoolVar(&cfg.KeepAlive, "keep-alive", cfg.KeepAlive, "reuse connections between requests")
+	flag.DurationVar((*time.Duration)(&cfg.DialTimeout), "dial-timeout", time.Duration(cfg.DialTimeout), "timeout for establishing a connection (includes DNS lookup)")
+	flag.StringVar(&cfg.HistogramBuckets, "histogram-buckets", cfg.HistogramBuckets, "comma-separated latency histogram bucket bounds in ms")
+	flag.BoolVar(&cfg.Verify, "verify", cfg.Verify, "after each add, GET the cart and check the item is in it")
+	flag.Float64Var(&cfg.MaxP99, "max-p99", cfg.MaxP99, "SLO: maximum p99 response time in ms for every operation (0 = no check)")
+	flag.Float64Var(&cfg.MinSuccessRate, "min-success-rate", cfg.MinSuccessRate, "SLO: minimum success rate in percent (0 = no check)")
+	flag.Parse()
+
+	if *configPath != "" {
+		// Remember the flags given on the command line, load the file over
+		// the defaults, then apply the flags again on top of it
+		explicit := make(map[string]string)
+		flag.Visit(func(f *flag.Flag) { explicit[f.Name] = f.Value.String() })
+
+		file, err := os.Open(*configPath)
+		if err != nil {
+			fmt.Printf("Error opening config file: %v\n", err)
+			os.Exit(1)
+		}
+		decoder := json.NewDecoder(file)
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&cfg)
+		file.Close()
+		if err != nil {
+			fmt.Printf("Invalid config file %s: %v\n", *configPath, err)
+			os.Exit(1)
+		}
+
+		for name, value := range explicit {
+			flag.Set(name, value)
+		}
+	}
+	if flag.NArg() > 0 {
+		cfg.BaseURL = flag.Arg(0)
+	}
+
+	if err := cfg.validate(); err != nil {
+		fmt.Printf("Invalid configuration:\n%v\n\n", err)
+		fmt.Println("Usage: go run dynamodb_test_concurrent.go [flags] <ALB_URL>")
+		fmt.Println("Example: go run dynamodb_test_concurrent.go -max-conns-per-host 50 http://your-alb.amazonaws.com")
+		fmt.Println("         go run dynamodb_test_concurrent.go -config loadtest.json -workers 20")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+}
+
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: go run dynamodb_test_concurrent.go <ALB_URL>")
-		fmt.Println("Example: go run dynamodb_test_concurrent.go http://your-alb.amazonaws.com")
+	loadConfig()
+
+	bounds, err := parseBuckets(cfg.HistogramBuckets)
+	if err != nil {
+		fmt.Printf("Invalid histogram buckets: %v\n", err)
 		os.Exit(1)
 	}
 
-	baseURL = os.Args[1]
-	httpClient = &http.Client{Timeout: 30 * time.Second}
+	baseURL = cfg.BaseURL
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = cfg.MaxIdleConns
+	transport.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	transport.MaxConnsPerHost = cfg.MaxConnsPerHost
+	// Without keep-alive every request dials (and resolves DNS) again, which
+	// also follows ALB DNS rotation immediately
+	transport.DisableKeepAlives = !cfg.KeepAlive
+	transport.DialContext = (&net.Dialer{Timeout: time.Duration(cfg.DialTimeout), KeepAlive: 30 * time.Second}).DialContext
+	httpClient = &http.Client{Timeout: time.Duration(cfg.RequestTimeout), Transport: &connTrackingTransport{base: transport}}
 
 	printHeader()
 
@@ -78,25 +277,25 @@ func main() {
 
 	// Generate unique customer IDs
 	baseCustomerID := rand.Intn(100000) + 10000
-	fmt.Printf("Using customer IDs: %d - %d\n\n", baseCustomerID, baseCustomerID+NumCreateCart-1)
+	fmt.Printf("Using customer IDs: %d - %d\n\n", baseCustomerID, baseCustomerID+cfg.NumCreateCart-1)
 
 	startTime := time.Now()
 
 	// Phase 1: Create carts concurrently
 	fmt.Println("Phase 1: Creating shopping carts concurrently...")
-	customerIDs := make([]int, NumCreateCart)
-	for i := 0; i < NumCreateCart; i++ {
+	customerIDs := make([]int, cfg.NumCreateCart)
+	for i := 0; i < cfg.NumCreateCart; i++ {
 		customerIDs[i] = baseCustomerID + i
 	}
 	
-	runConcurrent(NumCreateCart, func(i int) {
+	runConcurrent(cfg.NumCreateCart, func(i int) {
 		createCart(customerIDs[i])
 	})
 	fmt.Println("✓ Phase 1 complete")
 
 	// Phase 2: Add items concurrently
 	fmt.Println("Phase 2: Adding items to carts concurrently...")
-	runConcurrent(NumAddItems, func(i int) {
+	runConcurrent(cfg.NumAddItems, func(i int) {
 		customerID := customerIDs[i%len(customerIDs)]
 		addItemToCart(customerID)
 	})
@@ -104,7 +303,7 @@ func main() {
 
 	// Phase 3: Get carts concurrently
 	fmt.Println("Phase 3: Retrieving carts concurrently...")
-	runConcurrent(NumGetCart, func(i int) {
+	runConcurrent(cfg.NumGetCart, func(i int) {
 		customerID := customerIDs[i%len(customerIDs)]
 		getCart(customerID)
 	})
@@ -114,11 +313,13 @@ func main() {
 
 	// Calculate statistics
 	stats := calculateStatistics()
+	histograms := calculateHistograms(bounds)
 
 	// Create output
 	output := TestOutput{
 		Results:    results,
 		Statistics: stats,
+		Histograms: histograms,
 	}
 
 	// Save to JSON
@@ -126,6 +327,7 @@ func main() {
 
 	// Print summary
 	printSummary(duration, stats)
+	printHistograms(histograms)
 
 	// Check time limit
 	if duration > TimeLimit {
@@ -142,7 +344,37 @@ func main() {
 		fmt.Printf("⚠ Success rate: %.2f%%\n", successRate)
 	}
 
+	failures := checkSLOs(stats, successRate)
+	for _, failure := range failures {
+		fmt.Printf("✗ SLO failed: %s\n", failure)
+	}
+	if len(failures) == 0 && (cfg.MaxP99 > 0 || cfg.MinSuccessRate > 0) {
+		fmt.Println("✓ All SLOs met")
+	}
+
 	fmt.Println("============================================================")
+
+	if len(failures) > 0 {
+		os.Exit(1)
+	}
+}
+
+// checkSLOs compares the run against the configured SLOs and describes each
+// one that was breached
+func checkSLOs(stats map[string]OpStats, successRate float64) []string {
+	var failures []string
+	if cfg.MinSuccessRate > 0 && successRate < cfg.MinSuccessRate {
+		failures = append(failures, fmt.Sprintf("success rate %.2f%% < %g%%", successRate, cfg.MinSuccessRate))
+	}
+	if cfg.MaxP99 > 0 {
+		for _, opType := range []string{"create_cart", "add_items", "get_cart"} {
+			stat := stats[opType]
+			if stat.Count > 0 && stat.P99ResponseTime > cfg.MaxP99 {
+				failures = append(failures, fmt.Sprintf("%s p99 %.2f ms > %g ms", opType, stat.P99ResponseTime, cfg.MaxP99))
+			}
+		}
+	}
+	return failures
 }
 
 func printHeader() {
@@ -150,11 +382,19 @@ func printHeader() {
 	fmt.Println("Concurrent DynamoDB Shopping Cart Test (Go)")
 	fmt.Println("============================================================")
 	fmt.Printf("Target: %s\n", baseURL)
-	fmt.Printf("Concurrent Workers: %d\n", NumWorkers)
-	fmt.Printf("Total Operations: %d\n", TotalOps)
-	fmt.Printf("  - Create Cart: %d\n", NumCreateCart)
-	fmt.Printf("  - Add Items: %d\n", NumAddItems)
-	fmt.Printf("  - Get Cart: %d\n", NumGetCart)
+	fmt.Printf("Concurrent Workers: %d (ramp-up %s)\n", cfg.Workers, time.Duration(cfg.RampUp))
+	fmt.Printf("Total Operations: %d\n", cfg.NumCreateCart+cfg.NumAddItems+cfg.NumGetCart)
+	fmt.Printf("  - Create Cart: %d\n", cfg.NumCreateCart)
+	fmt.Printf("  - Add Items: %d\n", cfg.NumAddItems)
+	fmt.Printf("  - Get Cart: %d\n", cfg.NumGetCart)
+	fmt.Printf("Timeouts: request %s, dial %s\n", time.Duration(cfg.RequestTimeout), time.Duration(cfg.DialTimeout))
+	fmt.Printf("Connections: keep-alive %t, max idle %d (%d per host), max per host %d\n",
+		cfg.KeepAlive, cfg.MaxIdleConns, cfg.MaxIdleConnsPerHost, cfg.MaxConnsPerHost)
+	fmt.Printf("Histogram Buckets: %s ms\n", cfg.HistogramBuckets)
+	fmt.Printf("Verify Adds: %t\n", cfg.Verify)
+	if cfg.MaxP99 > 0 || cfg.MinSuccessRate > 0 {
+		fmt.Printf("SLOs: p99 <= %g ms, success rate >= %g%% (0 = not checked)\n", cfg.MaxP99, cfg.MinSuccessRate)
+	}
 	fmt.Println("Output: dynamodb_test_results.json")
 	fmt.Println("============================================================")
 }
@@ -170,10 +410,14 @@ func testConnectivity() bool {
 
 func runConcurrent(count int, taskFunc func(int)) []int {
 	var wg sync.WaitGroup
-	semaphore := make(chan struct{}, NumWorkers)
+	semaphore := make(chan struct{}, cfg.Workers)
 	customerIDs := make([]int, count)
 
 	for i := 0; i < count; i++ {
+		// Ramp up: start the first Workers tasks evenly over RampUp
+		if cfg.RampUp > 0 && i > 0 && i < cfg.Workers {
+			time.Sleep(time.Duration(cfg.RampUp) / time.Duration(cfg.Workers))
+		}
 		wg.Add(1)
 		go func(index int) {
 			defer wg.Done()
@@ -204,15 +448,10 @@ func createCart(customerID int) {
 	result := TestResult{
 		Operation:    "create_cart",
 		ResponseTime: duration,
-		Success:      err == nil && (resp.StatusCode == 200 || resp.StatusCode == 201),
 		Timestamp:    time.Now().UTC().Format(time.RFC3339),
 		CustomerID:   customerID,
 	}
-
-	if resp != nil {
-		result.StatusCode = resp.StatusCode
-		resp.Body.Close()
-	}
+	recordResponse(&result, resp, err, 200, 201)
 
 	addResult(result)
 }
@@ -237,19 +476,57 @@ func addItemToCart(customerID int) {
 	result := TestResult{
 		Operation:    "add_items",
 		ResponseTime: duration,
-		Success:      err == nil && (resp.StatusCode == 200 || resp.StatusCode == 201),
 		Timestamp:    time.Now().UTC().Format(time.RFC3339),
 		CustomerID:   customerID,
 	}
-
-	if resp != nil {
-		result.StatusCode = resp.StatusCode
-		resp.Body.Close()
+	recordResponse(&result, resp, err, 200, 201, 202) // 202 when the server buffers cart adds
+
+	// Buffered adds (202) aren't written yet, so they can't be verified
+	if cfg.Verify && result.Success && result.StatusCode != 202 {
+		if err := verifyCartItem(customerID, productID, quantity); err != nil {
+			fmt.Printf("✗ Verification failed for customer %d: %v\n", customerID, err)
+			result.Success = false
+			result.ErrorType = ErrVerify
+		}
 	}
 
 	addResult(result)
 }
 
+// verifyCartItem checks that the customer's cart holds at least quantity of
+// productID. Concurrent adds of the same product can only raise the quantity.
+func verifyCartItem(customerID, productID, quantity int) error {
+	url := fmt.Sprintf("%s/shopping-carts/%d", baseURL, customerID)
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to get cart: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("get cart returned %d", resp.StatusCode)
+	}
+
+	var cart struct {
+		Items []struct {
+			ProductID int `json:"product_id"`
+			Quantity  int `json:"quantity"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&cart); err != nil {
+		return fmt.Errorf("invalid cart response: %v", err)
+	}
+
+	for _, item := range cart.Items {
+		if item.ProductID == productID {
+			if item.Quantity < quantity {
+				return fmt.Errorf("product %d has quantity %d, expected at least %d", productID, item.Quantity, quantity)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("product %d is missing", productID)
+}
+
 func getCart(customerID int) {
 	startTime := time.Now()
 
@@ -261,18 +538,38 @@ func getCart(customerID int) {
 	result := TestResult{
 		Operation:    "get_cart",
 		ResponseTime: duration,
-		Success:      err == nil && resp.StatusCode == 200,
 		Timestamp:    time.Now().UTC().Format(time.RFC3339),
 		CustomerID:   customerID,
 	}
+	recordResponse(&result, resp, err, 200)
 
-	if resp != nil {
-		result.StatusCode = resp.StatusCode
-		io.Copy(io.Discard, resp.Body)
-		resp.Body.Close()
+	addResult(result)
+}
+
+// recordResponse fills in the status code, success flag and error category
+// of a result. It is safe to call with a nil resp (e.g. connection refused),
+// and always drains and closes the body when there is one.
+func recordResponse(result *TestResult, resp *http.Response, err error, okCodes ...int) {
+	if err != nil || resp == nil {
+		result.Success = false
+		result.ErrorType = ErrConnection
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return
 	}
 
-	addResult(result)
+	result.StatusCode = resp.StatusCode
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	for _, code := range okCodes {
+		if resp.StatusCode == code {
+			result.Success = true
+			return
+		}
+	}
+	result.ErrorType = ErrHTTPStatus
 }
 
 func addResult(result TestResult) {
@@ -289,10 +586,12 @@ func calculateStatistics() map[string]OpStats {
 		stat := OpStats{
 			MinResponseTime: 999999,
 		}
+		var responseTimes []float64
 
 		for _, result := range results {
 			if result.Operation == opType {
 				stat.Count++
+				responseTimes = append(responseTimes, result.ResponseTime)
 				stat.TotalResponseTime += result.ResponseTime
 
 				if result.Success {
@@ -312,6 +611,7 @@ func calculateStatistics() map[string]OpStats {
 
 		if stat.Count > 0 {
 			stat.AvgResponseTime = stat.TotalResponseTime / float64(stat.Count)
+			stat.P99ResponseTime = percentile(responseTimes, 99)
 		}
 
 		stats[opType] = stat
@@ -320,6 +620,68 @@ func calculateStatistics() map[string]OpStats {
 	return stats
 }
 
+// percentile returns the p-th percentile (nearest rank) of values, which must
+// not be empty. It sorts values in place.
+func percentile(values []float64, p float64) float64 {
+	sort.Float64s(values)
+	rank := int(math.Ceil(p / 100 * float64(len(values))))
+	return values[max(rank, 1)-1]
+}
+
+// parseBuckets parses a comma-separated list of bucket bounds in ms, which
+// must be positive and increasing
+func parseBuckets(value string) ([]float64, error) {
+	var bounds []float64
+	for _, field := range strings.Split(value, ",") {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", field)
+		}
+		if bound <= 0 || (len(bounds) > 0 && bound <= bounds[len(bounds)-1]) {
+			return nil, fmt.Errorf("bounds must be positive and increasing, got %v", value)
+		}
+		bounds = append(bounds, bound)
+	}
+	return bounds, nil
+}
+
+// calculateHistograms buckets every result's response time per operation.
+// With bounds 10,50 the buckets are 0-10ms, 10-50ms and 50ms+.
+func calculateHistograms(bounds []float64) map[string][]HistogramBucket {
+	histograms := make(map[string][]HistogramBucket)
+	opTypes := []string{"create_cart", "add_items", "get_cart"}
+
+	for _, opType := range opTypes {
+		buckets := make([]HistogramBucket, len(bounds)+1)
+		lower := 0.0
+		for i := range bounds {
+			upper := bounds[i]
+			buckets[i] = HistogramBucket{
+				Label: fmt.Sprintf("%g-%gms", lower, upper),
+				MinMs: lower,
+				MaxMs: &upper,
+			}
+			lower = upper
+		}
+		buckets[len(bounds)] = HistogramBucket{Label: fmt.Sprintf("%gms+", lower), MinMs: lower}
+
+		for _, result := range results {
+			if result.Operation != opType {
+				continue
+			}
+			i := sort.SearchFloat64s(bounds, result.ResponseTime)
+			if i < len(bounds) && result.ResponseTime == bounds[i] {
+				i++ // bounds are exclusive upper limits
+			}
+			buckets[i].Count++
+		}
+
+		histograms[opType] = buckets
+	}
+
+	return histograms
+}
+
 func saveResults(output TestOutput, filename string) {
 	file, err := os.Create(filename)
 	if err != nil {
@@ -346,14 +708,30 @@ func printSummary(duration time.Duration, stats map[string]OpStats) {
 	fmt.Printf("Total Operations: %d\n", len(results))
 	fmt.Printf("Successful: %d\n", countSuccessful())
 	fmt.Printf("Failed: %d\n", len(results)-countSuccessful())
-	fmt.Printf("Success Rate: %.2f%%\n\n", float64(countSuccessful())/float64(len(results))*100)
+	fmt.Printf("  Connection Errors: %d\n", countErrorType(ErrConnection))
+	if cfg.Verify {
+		fmt.Printf("  Verification Failures: %d\n", countErrorType(ErrVerify))
+	}
+	fmt.Printf("Success Rate: %.2f%%\n", float64(countSuccessful())/float64(len(results))*100)
+	fmt.Printf("Connections: %d new, %d reused\n\n", newConns.Load(), reusedConns.Load())
 
 	for opType, stat := range stats {
 		fmt.Printf("%s:\n", opType)
 		fmt.Printf("  Count: %d\n", stat.Count)
 		fmt.Printf("  Success: %d/%d\n", stat.Successful, stat.Count)
 		fmt.Printf("  Avg Response Time: %.2f ms\n", stat.AvgResponseTime)
-		fmt.Printf("  Min/Max: %.2f/%.2f ms\n\n", stat.MinResponseTime, stat.MaxResponseTime)
+		fmt.Printf("  Min/Max: %.2f/%.2f ms\n", stat.MinResponseTime, stat.MaxResponseTime)
+		fmt.Printf("  P99: %.2f ms\n\n", stat.P99ResponseTime)
+	}
+}
+
+func printHistograms(histograms map[string][]HistogramBucket) {
+	for opType, buckets := range histograms {
+		fmt.Printf("%s latency histogram:\n", opType)
+		for _, bucket := range buckets {
+			fmt.Printf("  %-14s %d\n", bucket.Label, bucket.Count)
+		}
+		fmt.Println()
 	}
 }
 
@@ -365,4 +743,14 @@ func countSuccessful() int {
 		}
 	}
 	return count
-}
\ No newline at end of file
+}
+
+func countErrorType(errorType string) int {
+	count := 0
+	for _, result := range results {
+		if result.ErrorType == errorType {
+			count++
+		}
+	}
+	return count
+}
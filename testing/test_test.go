@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRecordResponseConnectionRefused(t *testing.T) {
+	// Grab a free port and close it again so nothing is listening there
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	resp, err := http.Get("http://" + addr + "/shopping-carts")
+	if err == nil {
+		resp.Body.Close()
+		t.Fatalf("expected the connection to %s to be refused", addr)
+	}
+
+	var result TestResult
+	recordResponse(&result, resp, err, http.StatusCreated)
+	if result.Success {
+		t.Error("refused connection recorded as success")
+	}
+	if result.StatusCode != 0 {
+		t.Errorf("StatusCode = %d, want 0", result.StatusCode)
+	}
+	if result.ErrorType != ErrConnection {
+		t.Errorf("ErrorType = %q, want %q", result.ErrorType, ErrConnection)
+	}
+}
+
+func TestRecordResponseStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		path      string
+		success   bool
+		errorType string
+	}{
+		{"/shopping-carts", true, ""},
+		{"/missing", false, ErrHTTPStatus},
+	}
+	for _, tt := range tests {
+		resp, err := http.Get(server.URL + tt.path)
+		var result TestResult
+		recordResponse(&result, resp, err, http.StatusCreated, http.StatusOK)
+		if result.Success != tt.success || result.ErrorType != tt.errorType {
+			t.Errorf("%s: Success = %v, ErrorType = %q, want %v, %q",
+				tt.path, result.Success, result.ErrorType, tt.success, tt.errorType)
+		}
+		if result.StatusCode != resp.StatusCode {
+			t.Errorf("%s: StatusCode = %d, want %d", tt.path, result.StatusCode, resp.StatusCode)
+		}
+	}
+}